@@ -2,4 +2,8 @@ module github.com/scriptogre/op-dotenv
 
 go 1.24.3
 
-require github.com/urfave/cli/v3 v3.3.8
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/urfave/cli/v3 v3.3.8
+	gopkg.in/yaml.v3 v3.0.1
+)
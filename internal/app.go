@@ -1,173 +1,358 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/scriptogre/op-dotenv/internal/onepassword"
 )
 
 // App represents the application with its dependencies
 type App struct {
-	config *Config
+	config      *Config
+	backend     onepassword.Backend
+	env         string // selected environment, "" for the project's default file and item
+	account     string // account given with --account, "" to take it from the config
+	interactive bool   // whether prompts may be shown, errors are returned instead otherwise
+	otpCodes    bool   // whether pull writes current TOTP codes instead of OTP seeds
+	expand      bool   // whether pull writes values with their references expanded
+	showValues  bool   // whether conflict prompts show concealed values instead of masking them
+	batch       bool   // whether several files are synced, see ForEachFile
+	format      string // format push and diff read env files in, "" to tell from the file name
+
+	now func() time.Time // clock for TOTP codes
 }
 
-// NewApp creates a new application instance
-func NewApp() (*App, error) {
+// NewApp creates a new application instance backed by the given 1Password backend
+func NewApp(backend onepassword.Backend) (*App, error) {
 	config, err := LoadConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
 	return &App{
-		config: config,
+		config:      config,
+		backend:     backend,
+		interactive: StdinIsTerminal(),
+		now:         time.Now,
 	}, nil
 }
 
+// SetInteractive enables or disables prompts. It defaults to whether stdin is a
+// terminal. Without prompts, every situation that would ask the user fails with
+// an error instead, so CI jobs fail fast rather than hang.
+func (a *App) SetInteractive(interactive bool) {
+	a.interactive = interactive
+}
+
+// SetAccount makes the following commands use one of the 1Password accounts
+// signed in to, over the account of the project file and user config
+func (a *App) SetAccount(account string) {
+	a.account = account
+}
+
+// SetOTPCodes makes pull write the current code of each OTP field instead of
+// its seed. Pushing such a file keeps the seeds in 1Password.
+func (a *App) SetOTPCodes(codes bool) {
+	a.otpCodes = codes
+}
+
+// SetShowValues makes push and pull show concealed values when asking which
+// side of a conflict to keep, instead of masking them
+func (a *App) SetShowValues(show bool) {
+	a.showValues = show
+}
+
+// SelectEnvironment makes the following commands work on one environment of the
+// project, as configured in the project file or user config. An empty name
+// selects the project's default file and item.
+func (a *App) SelectEnvironment(env string) {
+	a.env = env
+}
+
+// Environments lists the environments configured for the working directory,
+// in the project file and the user config
+func (a *App) Environments() ([]string, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := FindProjectFile(workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	if project != nil {
+		for env := range project.Environments {
+			seen[env] = true
+		}
+	}
+	for env := range a.config.Projects[workingDir].Environments {
+		seen[env] = true
+	}
+
+	envs := make([]string, 0, len(seen))
+	for env := range seen {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	return envs, nil
+}
+
+// ForEachEnvironment runs fn once per configured environment, with that environment
+// selected. It keeps going when one fails and returns an error if any did.
+func (a *App) ForEachEnvironment(fn func() error) error {
+	envs, err := a.Environments()
+	if err != nil {
+		return err
+	}
+	if len(envs) == 0 {
+		return fmt.Errorf("no environments configured, add [environments.<name>] to %s", ProjectFileName)
+	}
+
+	defer a.SelectEnvironment(a.env)
+
+	var failed []string
+	for _, env := range envs {
+		fmt.Printf("\n%s %s\n", Bold("▸ Environment"), Bold(env))
+		a.SelectEnvironment(env)
+		if err := fn(); err != nil {
+			ShowError(fmt.Sprintf("%s %s: %v", Red("✗"), env, err))
+			failed = append(failed, env)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed for %d of %d environments: %s", len(failed), len(envs), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
 // Push uploads a .env file to 1Password
 func (a *App) Push(filePath, vault, item string, force bool) error {
 	// Validate dependencies first
-	if err := ValidateCliInstalled(); err != nil {
+	if err := ValidateCliInstalled(a.backend); err != nil {
 		ShowDependencyError(err)
 		os.Exit(1)
 	}
 
-	if err := ValidateUserSignedIn(); err != nil {
+	// Determine target file, vault and item
+	t, err := a.resolveTarget(filePath, vault, item)
+	if err != nil {
+		return err
+	}
+	filePath, targetVault, targetItem := t.FilePath, t.Vault, t.Item
+
+	if err := ValidateUserSignedIn(a.backend, t.Account); err != nil {
 		ShowDependencyError(err)
 		os.Exit(1)
 	}
 
-	// Determine target vault and item
-	targetVault, targetItem, err := a.resolveTarget(vault, item)
-	if err != nil {
+	// Try to resolve vault to ID (handles existence check)
+	vaultID, account, err := a.resolveVault(targetVault, t.Account)
+	var notFound *onepassword.VaultNotFoundError
+	if err != nil && !errors.As(err, &notFound) {
 		return err
 	}
-
-	// Try to resolve vault to ID (handles existence check)
-	vaultID, err := onepassword.GetVaultIdentifier(targetVault)
 	if err != nil {
+		if !a.interactive {
+			return errNonInteractive(fmt.Sprintf("vault '%s' not found", targetVault), "pass an existing vault with --vault")
+		}
+
 		// Vault not found - let user choose
-		selectedVault, err := HandleVaultNotFound(targetVault)
+		selectedVault, err := HandleVaultNotFound(a.backend, targetVault)
 		if err != nil {
 			return err
 		}
 		if selectedVault == "" {
 			return nil // User cancelled
 		}
-		// Update targetVault to use selected vault
+		// Update targetVault to use selected vault, of the same account
 		targetVault = selectedVault
+		if account != t.Account {
+			targetVault = selectedVault + "@" + account
+		}
 		// Get ID for selected vault
-		vaultID, err = onepassword.GetVaultIdentifier(selectedVault)
+		vaultID, account, err = a.resolveVault(selectedVault, account)
 		if err != nil {
 			return fmt.Errorf("failed to resolve selected vault: %w", err)
 		}
 	}
 
-	// Parse .env file to 1Password item
-	parsedItem, err := ParseEnvFileToItem(filePath, targetItem)
+	// Parse .env file (or a file in another format) to 1Password item
+	parsedItem, err := parseFile(filePath, targetItem, a.format, t.Conceal)
 	if err != nil {
 		return fmt.Errorf("failed to parse %s: %w", filePath, err)
 	}
 
-	// Check if item exists and confirm overwrite
-	if onepassword.ItemExists(vaultID, targetItem) {
-		if !force && !ConfirmOverwrite("Item", targetItem, "vault '"+targetVault+"'") {
-			return nil
-		}
+	status := StatusInSync
+	existingItem, err := a.getItem(vaultID, targetItem)
+	if err != nil {
+		existingItem = nil
 	}
 
-	// Extract notes and fields from item
-	notes := ""
-	var fields []onepassword.OnePasswordField
-
-	for _, field := range parsedItem.Fields {
-		if field.ID == "notesPlain" {
-			notes = field.Value
+	// TOTP codes written by `pull --otp code` stand for the seeds in 1Password
+	if missing := restoreOTPSeeds(parsedItem, existingItem); len(missing) > 0 {
+		return fmt.Errorf("%s hold TOTP codes instead of seeds: pull with --otp seed before pushing", strings.Join(missing, ", "))
+	}
+	a.restoreReferences(parsedItem, existingItem)
+	keepConcealed(parsedItem, existingItem)
+
+	if existingItem == nil {
+		// Item doesn't exist yet - create it
+		notes := itemNotes(parsedItem).Value
+		fields := append(storedFields(envFields(parsedItem)), descriptionFields(parsedItem)...)
+		if layout, ok := itemLayout(parsedItem); ok {
+			fields = append(fields, layout)
+		}
+		if references, ok := referencesField(parsedItem); ok {
+			fields = append(fields, references)
+		}
+		if err := a.backend.CreateItemFromFields(vaultID, targetItem, notes, fields); err != nil {
+			return fmt.Errorf("failed to create 1Password item: %w", err)
+		}
+	} else {
+		// Item exists - merge with changes made in 1Password since the last sync,
+		// unless forced to overwrite them. Overwriting asks first if the item
+		// changed since then.
+		merged := parsedItem
+		if force {
+			state := a.syncBase(filePath, targetVault, targetItem)
+			if state != nil && state.remoteChanged(existingItem) && !a.confirmOverwriteNewer(targetVault+"/"+targetItem+" in 1Password") {
+				return nil
+			}
 		} else {
-			fields = append(fields, field)
+			var conflicts []MergeConflict
+			merged, conflicts = mergeItems(a.syncBase(filePath, targetVault, targetItem), parsedItem, existingItem)
+			if len(conflicts) > 0 {
+				if !a.interactive {
+					return fmt.Errorf("%s changed both locally and in 1Password since the last sync: pull to merge them first, or use --force to overwrite 1Password", conflictLabels(conflicts))
+				}
+				if !a.resolveConflicts(merged, conflicts) {
+					return nil
+				}
+			}
 		}
-	}
 
-	// Create or update the item
-	if onepassword.ItemExists(vaultID, targetItem) {
-		// Delete existing item and recreate to ensure proper field types and section order
-		existingItem, err := onepassword.GetItemByName(vaultID, targetItem)
-		if err != nil {
-			return err
+		// Edit the item in place so its ID and history survive. Descriptions,
+		// the layout of the file and the variables holding references aren't
+		// variables, but are kept up to date along with them.
+		changes := DiffItems(existingItem, merged)
+		edits := append(changes, referencesChanges(existingItem, merged)...)
+		if layout, ok := itemLayout(parsedItem); ok {
+			edits = append(edits, descriptionChanges(existingItem, merged)...)
+			if old, exists := itemLayout(existingItem); !exists {
+				edits = append(edits, FieldChange{Kind: FieldAdded, Label: layout.Label, New: layout})
+			} else if old.Value != layout.Value {
+				edits = append(edits, FieldChange{Kind: FieldChanged, Label: layout.Label, Old: old, New: layout})
+			}
 		}
-		
-		// Delete the existing item
-		deleteCmd := exec.Command("op", "item", "delete", existingItem.ID, "--vault", vaultID)
-		if _, err := deleteCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to delete existing item: %w", err)
+		if len(edits) > 0 {
+			if err := a.applyChanges(vaultID, existingItem.ID, edits); err != nil {
+				return fmt.Errorf("failed to update 1Password item: %w", err)
+			}
+		}
+
+		if pending := len(DiffItems(parsedItem, merged)); pending > 0 {
+			status = StatusRemoteAhead
+			fmt.Printf("\n%s Kept %d change(s) made in 1Password that aren't in %s yet. Pull to get them.\n", Yellow("⚠"), pending, Bold(filePath))
+		}
+
+		if len(edits) == 0 {
+			a.recordSync(filePath, targetVault, targetItem, parsedItem, existingItem, status)
+			a.rememberTarget(targetVault, t.Account, targetItem)
+			fmt.Printf("\n✅ %s is already up to date.\n", Bold(targetVault+"/"+targetItem))
+			return nil
 		}
-		
-		// Create new item with updated structure
-		err = onepassword.CreateItemFromFields(vaultID, targetItem, notes, fields)
-	} else {
-		err = onepassword.CreateItemFromFields(vaultID, targetItem, notes, fields)
 	}
 
+	// The file as pushed is the base of the next merge. Changes kept from
+	// 1Password still count as remote changes, so the next pull brings them in.
+	pushedItem, err := a.getItem(vaultID, targetItem)
 	if err != nil {
-		return fmt.Errorf("failed to update 1Password item: %w", err)
+		pushedItem = nil
 	}
+	a.recordSync(filePath, targetVault, targetItem, parsedItem, pushedItem, status)
 
 	// Save the vault and item choices for future use
-	workingDir, _ := os.Getwd()
-	a.config.SetVault(workingDir, targetVault)
-	a.config.SetItem(workingDir, targetItem)
-	a.config.Save() // Ignore error - not critical
+	a.rememberTarget(targetVault, t.Account, targetItem)
 
 	ShowSuccess("Saved", filePath, targetVault+"/"+targetItem+" in 1Password")
 	return nil
 }
 
 // Pull downloads a 1Password item to a .env file
-func (a *App) Pull(filePath, vault, item string) error {
+func (a *App) Pull(filePath, vault, item string, force bool) error {
 	// Validate dependencies first
-	if err := ValidateCliInstalled(); err != nil {
+	if err := ValidateCliInstalled(a.backend); err != nil {
 		ShowDependencyError(err)
 		os.Exit(1)
 	}
 
-	if err := ValidateUserSignedIn(); err != nil {
+	// Determine target file, vault and item
+	t, err := a.resolveTarget(filePath, vault, item)
+	if err != nil {
+		return err
+	}
+	filePath, targetVault, targetItem := t.FilePath, t.Vault, t.Item
+
+	if err := ValidateUserSignedIn(a.backend, t.Account); err != nil {
 		ShowDependencyError(err)
 		os.Exit(1)
 	}
 
-	// Determine target vault and item
-	targetVault, targetItem, err := a.resolveTarget(vault, item)
-	if err != nil {
-		return err
+	// Only .env files are written, other formats would be overwritten with one
+	if format := fileFormat(filePath, a.format); format != "dotenv" {
+		return fmt.Errorf("pull only writes .env files and %s is %s, use `op-dotenv export` for other formats", filePath, format)
 	}
 
 	// Try to resolve vault to ID (handles existence check)
-	vaultID, err := onepassword.GetVaultIdentifier(targetVault)
+	vaultID, account, err := a.resolveVault(targetVault, t.Account)
+	var notFound *onepassword.VaultNotFoundError
+	if err != nil && !errors.As(err, &notFound) {
+		return err
+	}
 	if err != nil {
+		if !a.interactive {
+			return errNonInteractive(fmt.Sprintf("vault '%s' not found", targetVault), "pass an existing vault with --vault")
+		}
+
 		// Vault not found - let user choose
-		selectedVault, err := HandleVaultNotFound(targetVault)
+		selectedVault, err := HandleVaultNotFound(a.backend, targetVault)
 		if err != nil {
 			return err
 		}
 		if selectedVault == "" {
 			return nil // User cancelled
 		}
-		// Update targetVault to use selected vault
+		// Update targetVault to use selected vault, of the same account
 		targetVault = selectedVault
+		if account != t.Account {
+			targetVault = selectedVault + "@" + account
+		}
 		// Get ID for selected vault
-		vaultID, err = onepassword.GetVaultIdentifier(selectedVault)
+		vaultID, account, err = a.resolveVault(selectedVault, account)
 		if err != nil {
 			return fmt.Errorf("failed to resolve selected vault: %w", err)
 		}
 	}
 
 	// Get item from 1Password
-	opItem, err := onepassword.GetItemByName(vaultID, targetItem)
+	opItem, err := a.getItem(vaultID, targetItem)
 	if err != nil {
+		if !a.interactive {
+			return errNonInteractive(fmt.Sprintf("item '%s' not found in vault '%s'", targetItem, targetVault), "pass an existing item with --item")
+		}
+
 		// Item not found - let user choose
-		selectedItem, err := HandleItemNotFound(targetVault, targetItem)
+		selectedItem, err := HandleItemNotFound(a.backend, vaultID, targetVault, targetItem)
 		if err != nil {
 			return err
 		}
@@ -177,53 +362,602 @@ func (a *App) Pull(filePath, vault, item string) error {
 		// Update targetItem to use selected item
 		targetItem = selectedItem
 		// Get the selected item
-		opItem, err = onepassword.GetItemByName(vaultID, selectedItem)
+		opItem, err = a.getItem(vaultID, selectedItem)
 		if err != nil {
 			return fmt.Errorf("failed to get selected item: %w", err)
 		}
 	}
 
-	// Check if file exists and confirm overwrite
-	if _, err := os.Stat(filePath); err == nil {
-		if !ConfirmOverwrite("File", filePath, "local filesystem") {
+	// Merge with local changes made since the last sync, unless forced to overwrite them.
+	// Overwriting asks first if the file changed since then.
+	result := opItem
+	content, readErr := os.ReadFile(filePath)
+	if readErr == nil && force {
+		state := a.syncBase(filePath, targetVault, targetItem)
+		if state != nil && state.localChanged(content) && !a.confirmOverwriteNewer(filePath) {
 			return nil
 		}
+	} else if readErr == nil {
+		localItem, err := parseEnvFile(filePath, targetItem, t.Conceal)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s (use --force to overwrite it): %w", filePath, err)
+		}
+		restoreOTPSeeds(localItem, opItem)
+		a.restoreReferences(localItem, opItem)
+		keepConcealed(localItem, opItem)
+
+		merged, conflicts := mergeItems(a.syncBase(filePath, targetVault, targetItem), localItem, opItem)
+		if len(conflicts) > 0 && !a.interactive {
+			return a.writeConflicts(filePath, targetVault, t.Account, targetItem, merged, opItem, conflicts, t.Conceal)
+		}
+		if len(conflicts) > 0 && !a.resolveConflicts(merged, conflicts) {
+			return nil
+		}
+
+		// Codes expire and references may expand differently, so a pull
+		// writing them always rewrites the file
+		if len(DiffItems(localItem, merged)) == 0 && len(descriptionChanges(localItem, merged)) == 0 && !a.otpCodes && !a.expand {
+			a.recordSync(filePath, targetVault, targetItem, opItem, opItem, pulledStatus(opItem, merged))
+			a.rememberTarget(targetVault, t.Account, targetItem)
+			fmt.Printf("\n✅ %s is already up to date.\n", Bold(filePath))
+			return nil
+		}
+		result = merged
+	}
+
+	status := pulledStatus(opItem, result)
+	if a.expand {
+		if result, err = a.expandItem(result); err != nil {
+			return err
+		}
+		for i, field := range result.Fields {
+			if isEnvField(field) {
+				result.Fields[i].Value = literalValue(field.Value)
+			}
+		}
+	}
+	if a.otpCodes {
+		if result, err = withTOTPCodes(result, a.now()); err != nil {
+			return err
+		}
 	}
 
-	// Write item to .env file
-	err = WriteItemToEnvFile(filePath, opItem)
+	// Write item to .env file, which may be new to a directory listed in [[files]]
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to generate %s: %w", filePath, err)
+	}
+	err = writeMergedEnvFile(filePath, result, nil, t.Conceal)
 	if err != nil {
 		return fmt.Errorf("failed to generate %s: %w", filePath, err)
 	}
 
+	// 1Password as pulled is the base of the next merge. Local changes kept
+	// in the file still count as local changes, so the next push sends them.
+	a.recordSync(filePath, targetVault, targetItem, opItem, opItem, status)
+
 	// Save the vault and item choices for future use
-	workingDir, _ := os.Getwd()
-	a.config.SetVault(workingDir, targetVault)
-	a.config.SetItem(workingDir, targetItem)
-	a.config.Save() // Ignore error - not critical
+	a.rememberTarget(targetVault, t.Account, targetItem)
 
 	ShowSuccess("Saved", targetVault+"/"+targetItem, filePath+" from 1Password")
 	return nil
 }
 
-// resolveTarget determines the target vault and item names
-func (a *App) resolveTarget(vault, item string) (string, string, error) {
+// Diff compares a .env file with its 1Password item without changing either.
+// It reports whether the two have drifted apart.
+func (a *App) Diff(filePath, vault, item string, showValues bool) (bool, error) {
+	// Validate dependencies first. Exit code 1 means drift, so they are
+	// returned as errors rather than exiting.
+	if err := ValidateCliInstalled(a.backend); err != nil {
+		return false, err
+	}
+
+	// Determine target file, vault and item
+	t, err := a.resolveTarget(filePath, vault, item)
+	if err != nil {
+		return false, err
+	}
+	filePath, targetVault, targetItem := t.FilePath, t.Vault, t.Item
+
+	if err := ValidateUserSignedIn(a.backend, t.Account); err != nil {
+		return false, err
+	}
+
+	vaultID, _, err := a.resolveVault(targetVault, t.Account)
+	if err != nil {
+		return false, err
+	}
+
+	localItem, err := parseFile(filePath, targetItem, a.format, t.Conceal)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+
+	// A missing item is compared as empty, which is what a push would create
+	remoteItem, err := a.getItem(vaultID, targetItem)
+	if err != nil {
+		remoteItem = &onepassword.OnePasswordItem{Title: targetItem}
+	}
+
+	restoreOTPSeeds(localItem, remoteItem)
+	a.restoreReferences(localItem, remoteItem)
+	keepConcealed(localItem, remoteItem)
+
+	changes := DiffItems(remoteItem, localItem)
+	ShowDiff(filePath, targetVault+"/"+targetItem, changes, showValues)
+
+	return len(changes) > 0, nil
+}
+
+// Status reports which of a .env file and its 1Password item changed since the
+// last push or pull, without changing either.
+func (a *App) Status(filePath, vault, item string) (SyncStatus, error) {
+	// Validate dependencies first. Exit code 1 means out of sync, so they are
+	// returned as errors rather than exiting.
+	if err := ValidateCliInstalled(a.backend); err != nil {
+		return "", err
+	}
+
+	// Determine target file, vault and item
+	t, err := a.resolveTarget(filePath, vault, item)
+	if err != nil {
+		return "", err
+	}
+	filePath, targetVault, targetItem := t.FilePath, t.Vault, t.Item
+
+	if err := ValidateUserSignedIn(a.backend, t.Account); err != nil {
+		return "", err
+	}
+
+	vaultID, _, err := a.resolveVault(targetVault, t.Account)
+	if err != nil {
+		return "", err
+	}
+
+	// A missing file or item counts as changed
+	content, _ := os.ReadFile(filePath)
+	remoteItem, err := a.getItem(vaultID, targetItem)
+	if err != nil {
+		remoteItem = nil
+	}
+
+	status := StatusNeverSynced
+	if state := a.syncBase(filePath, targetVault, targetItem); state != nil {
+		status = state.status(content, remoteItem)
+	}
+
+	ShowStatus(filePath, targetVault+"/"+targetItem, status)
+	return status, nil
+}
+
+// resolveVault returns the ID of a vault given by name, ID or name@account, in
+// the given account unless the vault names its own, and the account it is in.
+// A vault named like name@account is found by its whole name first.
+func (a *App) resolveVault(vault, account string) (string, string, error) {
+	id, err := a.findVault(vault, account)
+	var notFound *onepassword.VaultNotFoundError
+	if name, vaultAccount := onepassword.SplitVaultAccount(vault); vaultAccount != "" && errors.As(err, &notFound) {
+		if err := ValidateUserSignedIn(a.backend, vaultAccount); err != nil {
+			return "", "", err
+		}
+		account = vaultAccount
+		id, err = a.findVault(name, account)
+	}
+	return id, account, err
+}
+
+// findVault returns the ID of a vault of an account given by name or ID. The ID
+// a name resolves to is remembered for the working directory, so that the name
+// keeps meaning that vault when another one gets the same name. A name that
+// several vaults already have is asked about, or fails without prompts.
+func (a *App) findVault(name, account string) (string, error) {
+	a.backend.SetAccount(account)
+
+	// Names are remembered with their account, the same name can be in several
+	vault := name
+	if account != "" {
+		vault = name + "@" + account
+	}
+
+	workingDir, _ := os.Getwd()
+	if id := a.config.Projects[workingDir].VaultIDs[vault]; id != "" {
+		if vaults, err := a.backend.ListVaults(); err == nil {
+			for _, v := range vaults {
+				if v.ID == id && v.Name == name {
+					return id, nil
+				}
+			}
+		}
+	}
+
+	id, err := onepassword.GetVaultIdentifier(a.backend, name)
+	var ambiguous *onepassword.AmbiguousVaultError
+	if errors.As(err, &ambiguous) {
+		if !a.interactive {
+			ids := make([]string, len(ambiguous.Vaults))
+			for i, v := range ambiguous.Vaults {
+				ids[i] = v.ID
+			}
+			return "", errNonInteractive(err.Error(), "pass the ID of one with --vault ("+strings.Join(ids, ", ")+")")
+		}
+		id, err = ChooseAmbiguousVault(ambiguous)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if id != name && a.config.Projects[workingDir].VaultIDs[vault] != id {
+		a.config.SetVaultID(workingDir, vault, id)
+		a.config.Save() // Ignore error - not critical
+	}
+	return id, nil
+}
+
+// getItem fetches an item with its values in the form .env files hold them
+func (a *App) getItem(vaultID, itemName string) (*onepassword.OnePasswordItem, error) {
+	item, err := a.backend.GetItemByName(vaultID, itemName)
+	if err != nil {
+		return nil, err
+	}
+	normalizeFields(item)
+	loadValues(item)
+	return item, nil
+}
+
+// fetchItem validates the 1Password CLI and fetches the item that vault and item
+// resolve to, for commands that only read it
+func (a *App) fetchItem(vault, item string) (target, *onepassword.OnePasswordItem, error) {
+	// Validate dependencies first
+	if err := ValidateCliInstalled(a.backend); err != nil {
+		ShowDependencyError(err)
+		os.Exit(1)
+	}
+
+	// Determine target vault and item
+	t, err := a.resolveTarget("", vault, item)
+	if err != nil {
+		return target{}, nil, err
+	}
+
+	if err := ValidateUserSignedIn(a.backend, t.Account); err != nil {
+		ShowDependencyError(err)
+		os.Exit(1)
+	}
+
+	vaultID, _, err := a.resolveVault(t.Vault, t.Account)
+	if err != nil {
+		return target{}, nil, err
+	}
+
+	opItem, err := a.getItem(vaultID, t.Item)
+	if err != nil {
+		return target{}, nil, err
+	}
+	return t, opItem, nil
+}
+
+// applyChanges edits an existing item so that only the changed fields are touched
+func (a *App) applyChanges(vaultID, itemID string, changes []FieldChange) error {
+	notes := ""
+	var upserts, removals []onepassword.OnePasswordField
+
+	for _, change := range changes {
+		switch {
+		case change.Label == "notesPlain":
+			if change.New.Value == "" {
+				removals = append(removals, change.Old)
+			} else {
+				notes = change.New.Value
+			}
+		case change.Kind == FieldRemoved:
+			removals = append(removals, change.Old)
+		case change.SectionChanged():
+			// Fields are addressed by section, so a move is a delete plus an add
+			removals = append(removals, change.Old)
+			upserts = append(upserts, change.New)
+		default:
+			upserts = append(upserts, change.New)
+		}
+	}
+
+	if len(removals) > 0 {
+		if err := a.backend.DeleteItemFields(vaultID, itemID, removals); err != nil {
+			return err
+		}
+	}
+
+	if notes != "" || len(upserts) > 0 {
+		if err := a.backend.UpdateItemFields(vaultID, itemID, notes, storedFields(upserts)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveConflicts asks which side wins each conflict of a merge. It returns
+// false if the user cancelled.
+func (a *App) resolveConflicts(merged *onepassword.OnePasswordItem, conflicts []MergeConflict) bool {
+	for _, conflict := range conflicts {
+		useLocal, ok := ResolveConflict(conflict, a.showValues)
+		if !ok {
+			return false
+		}
+		resolveConflict(merged, conflict, useLocal)
+	}
+	return true
+}
+
+// writeConflicts writes a merge with unresolved conflicts to the env file,
+// marking both versions of each conflicting variable for the user to pick from
+func (a *App) writeConflicts(filePath, vault, account, item string, merged, remote *onepassword.OnePasswordItem, conflicts []MergeConflict, conceal *concealer) error {
+	marked := make(map[string]MergeConflict)
+	for _, conflict := range conflicts {
+		marked[conflict.Label] = conflict
+	}
+	if err := writeMergedEnvFile(filePath, merged, marked, conceal); err != nil {
+		return fmt.Errorf("failed to generate %s: %w", filePath, err)
+	}
+
+	// 1Password is the base of the next merge, so that pushing the resolved
+	// file isn't a conflict again
+	a.recordSync(filePath, vault, item, remote, remote, StatusLocalAhead)
+	a.rememberTarget(vault, account, item)
+
+	return fmt.Errorf("%s changed both locally and in 1Password since the last sync: resolve the conflicts marked in %s, then push", conflictLabels(conflicts), filePath)
+}
+
+// syncBase returns the base snapshot of an env file for a three-way merge
+func (a *App) syncBase(filePath, vault, item string) *SyncState {
+	path, _ := filepath.Abs(filePath)
+	return a.config.GetSync(path, vault, item)
+}
+
+// recordSync stores the state of an env file after a push or pull. base is the
+// base of the next merge and remote the item as it is now in 1Password (nil if
+// unknown). status tells which side, if any, was left behind by the sync.
+func (a *App) recordSync(filePath, vault, itemName string, base, remote *onepassword.OnePasswordItem, status SyncStatus) {
+	path, _ := filepath.Abs(filePath)
+	state := newSyncState(vault, itemName, base)
+
+	if remote != nil {
+		state.ItemID = remote.ID
+		if status != StatusRemoteAhead {
+			state.Version, state.UpdatedAt = remote.Version, remote.UpdatedAt
+		}
+	}
+	if status != StatusLocalAhead {
+		if content, err := os.ReadFile(filePath); err == nil {
+			state.FileHash = state.hashBytes(content)
+		}
+	}
+
+	a.config.SetSync(path, state)
+}
+
+// pulledStatus tells whether a pull left local changes in the file that are not in 1Password yet
+func pulledStatus(remote, pulled *onepassword.OnePasswordItem) SyncStatus {
+	if len(DiffItems(remote, pulled)) > 0 {
+		return StatusLocalAhead
+	}
+	return StatusInSync
+}
+
+// confirmOverwriteNewer warns that a forced push or pull overwrites changes made
+// to name since the last sync. Only interactive runs are asked to confirm.
+func (a *App) confirmOverwriteNewer(name string) bool {
+	if !a.interactive {
+		fmt.Fprintf(os.Stderr, "%s %s changed since the last sync, overwriting it.\n", Yellow("⚠"), name)
+		return true
+	}
+	return ConfirmOverwriteNewer(name)
+}
+
+// rememberTarget saves the vault, account and item choices for the current
+// directory and selected environment
+func (a *App) rememberTarget(vault, account, item string) {
+	workingDir, _ := os.Getwd()
+	if a.batch {
+		// Only sync states are saved for files synced together
+	} else if a.env != "" {
+		a.config.SetEnvironment(workingDir, a.env, vault, account, item)
+	} else {
+		a.config.SetVault(workingDir, vault)
+		a.config.SetAccount(workingDir, account)
+		a.config.SetItem(workingDir, item)
+	}
+	a.config.Save() // Ignore error - not critical
+}
+
+// errNonInteractive reports a problem that would have needed a prompt
+func errNonInteractive(problem, hint string) error {
+	return fmt.Errorf("%s: can't prompt in non-interactive mode, %s", problem, hint)
+}
+
+// target is what a command works on: a local env file and a 1Password item
+type target struct {
+	Env      string
+	FilePath string
+	Vault    string
+	Account  string // 1Password account of the vault, "" for the default one
+	Item     string
+
+	// Conceal decides the field type of each variable
+	Conceal *concealer
+
+	// Where each value came from, shown by `op-dotenv config`
+	ProjectPath   string
+	FileSource    string
+	VaultSource   string
+	AccountSource string
+	ItemSource    string
+	ConcealSource string
+}
+
+// resolveTarget determines the env file, vault, account and item. Each value
+// is taken from the first of these that sets it:
+//
+//  1. command-line arguments and flags
+//  2. the project file (.op-dotenv.toml) in the working directory or a parent
+//  3. the user config (~/.config/op-dotenv/config.json) for the working directory
+//  4. defaults: .env, the Environments vault and an item named after the project
+//     directory (the one holding the project file, or the working directory)
+//
+// The account has no default, `op` then uses the one it was last signed in to.
+// A vault given as name@account overrides it, see resolveVault.
+//
+// When an environment is selected with --env, its own entries in the project
+// file and user config come first. Its vault falls back to the project's, and
+// its file and item default to .env.<env> and <item>-<env>.
+func (a *App) resolveTarget(filePath, vault, item string) (target, error) {
 	workingDir, err := os.Getwd()
 	if err != nil {
-		return "", "", err
+		return target{}, err
 	}
 
-	targetVault := vault
-	targetItem := item
+	project, err := FindProjectFile(workingDir)
+	if err != nil {
+		return target{}, err
+	}
+
+	projectDir := workingDir
+	var projectFile, projectVault, projectAccount, projectItem string
+	var projectEnv EnvironmentConfig
+	if project != nil {
+		projectDir = project.Dir()
+		projectFile = relPath(workingDir, project.EnvFilePath(""))
+		projectVault, projectAccount, projectItem = project.Vault, project.Account, project.Item
+		projectEnv = project.Environments[a.env]
+		projectEnv.File = relPath(workingDir, project.EnvFilePath(a.env))
+	}
 
-	if targetVault == "" {
-		targetVault = a.config.GetVault(workingDir, "Environments")
+	t := target{Env: a.env}
+	if project != nil {
+		t.ProjectPath = project.Path()
 	}
-	if targetItem == "" {
-		targetItem = a.config.GetItem(workingDir, filepath.Base(workingDir))
+	userConfig := a.config.Projects[workingDir]
+	userEnv := userConfig.Environments[a.env]
+
+	// Values of the project as a whole, without environments
+	baseFile, baseFileSource := firstSet(
+		setting{projectFile, "project file"},
+		setting{relPath(workingDir, filepath.Join(projectDir, ".env")), "default"},
+	)
+	baseVault, baseVaultSource := firstSet(
+		setting{projectVault, "project file"},
+		setting{userConfig.Vault, "user config"},
+		setting{"Environments", "default"},
+	)
+	baseAccount, baseAccountSource := firstSet(
+		setting{projectAccount, "project file"},
+		setting{userConfig.Account, "user config"},
+	)
+	baseItem, baseItemSource := firstSet(
+		setting{projectItem, "project file"},
+		setting{userConfig.Item, "user config"},
+		setting{filepath.Base(projectDir), "default"},
+	)
+
+	if a.env != "" {
+		envDefault := "default for --env " + a.env
+		baseFile, baseFileSource = firstSet(
+			setting{projectEnv.File, "project file, environment " + a.env},
+			setting{userEnv.File, "user config, environment " + a.env},
+			setting{relPath(workingDir, filepath.Join(projectDir, ".env."+a.env)), envDefault},
+		)
+		baseVault, baseVaultSource = firstSet(
+			setting{projectEnv.Vault, "project file, environment " + a.env},
+			setting{userEnv.Vault, "user config, environment " + a.env},
+			setting{baseVault, baseVaultSource},
+		)
+		baseAccount, baseAccountSource = firstSet(
+			setting{projectEnv.Account, "project file, environment " + a.env},
+			setting{userEnv.Account, "user config, environment " + a.env},
+			setting{baseAccount, baseAccountSource},
+		)
+		baseItem, baseItemSource = firstSet(
+			setting{projectEnv.Item, "project file, environment " + a.env},
+			setting{userEnv.Item, "user config, environment " + a.env},
+			setting{baseItem + "-" + a.env, envDefault},
+		)
 	}
 
-	return targetVault, targetItem, nil
+	// Concealment rules apply to every environment
+	rules, rulesSource := ConcealRules{}, "default"
+	if project != nil && project.Conceal != nil {
+		rules, rulesSource = *project.Conceal, "project file"
+	} else if a.config.Conceal != nil {
+		rules, rulesSource = *a.config.Conceal, "user config"
+	}
+	if t.Conceal, err = rules.compile(); err != nil {
+		return target{}, fmt.Errorf("%s: %w", rulesSource, err)
+	}
+	t.ConcealSource = rulesSource
+
+	t.FilePath, t.FileSource = firstSet(setting{filePath, "argument"}, setting{baseFile, baseFileSource})
+	t.Vault, t.VaultSource = firstSet(setting{vault, "--vault flag"}, setting{baseVault, baseVaultSource})
+	t.Item, t.ItemSource = firstSet(setting{item, "--item flag"}, setting{baseItem, baseItemSource})
+	t.Account, t.AccountSource = firstSet(setting{a.account, "--account flag"}, setting{baseAccount, baseAccountSource})
+
+	return t, nil
+}
+
+// setting is a candidate value for a target and where it came from
+type setting struct {
+	value  string
+	source string
+}
+
+// firstSet returns the first non-empty setting
+func firstSet(settings ...setting) (string, string) {
+	for _, s := range settings {
+		if s.value != "" {
+			return s.value, s.source
+		}
+	}
+	return "", ""
+}
+
+// relPath makes path relative to dir when that keeps it inside dir, for shorter messages
+func relPath(dir, path string) string {
+	if path == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// ShowConfig prints the resolved configuration for the working directory
+// and where each value comes from
+func (a *App) ShowConfig(vault, item string) error {
+	t, err := a.resolveTarget("", vault, item)
+	if err != nil {
+		return err
+	}
+
+	workingDir, _ := os.Getwd()
+	fmt.Printf("Current configuration for %s:\n", workingDir)
+	if t.ProjectPath != "" {
+		fmt.Printf("  Project file: %s\n", t.ProjectPath)
+	}
+	if t.Env != "" {
+		fmt.Printf("  Environment: %s\n", t.Env)
+	}
+	fmt.Printf("  Vault: %s (%s)\n", t.Vault, t.VaultSource)
+	if t.Account != "" {
+		fmt.Printf("  Account: %s (%s)\n", t.Account, t.AccountSource)
+	}
+	fmt.Printf("  Item:  %s (%s)\n", t.Item, t.ItemSource)
+	fmt.Printf("  File:  %s (%s)\n", t.FilePath, t.FileSource)
+	fmt.Printf("  Conceal: %s (%s)\n", t.Conceal.describe(), t.ConcealSource)
+
+	if envs, err := a.Environments(); err == nil && len(envs) > 0 {
+		fmt.Printf("  Environments: %s\n", strings.Join(envs, ", "))
+	}
+
+	return nil
 }
 
 // Clean removes all configuration data
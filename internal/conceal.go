@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// defaultConcealPattern matches variable names holding a word that usually marks a
+// secret, leaning towards concealing. Words that rarely appear in other words
+// match anywhere in the name, so DBPASSWORD and githubToken do. Short ones match
+// at the end of the name (APPKEY, DBPASS) or as words of their own, separated
+// by _, - or . or starting with a capital in camelCase, so MONKEY_COUNT,
+// PASSENGER_LIMIT and AUTHOR don't match. Exclude rules exempt other names.
+const defaultConcealPattern = `(?i:PASSWORD|PASSWD|PASSPHRASE|SECRET|TOKEN|PRIVATE|CREDENTIAL)` +
+	`|(?i:(PASS|PWD|PW|KEY|AUTH|HASH|SALT|DSN|PEM)S?$)` +
+	`|(?i:(^|[_.-])(PASS|PWD|PW|KEY|APIKEY|AUTH|HASH|SALT|DSN|PEM)S?($|[_.-]))` +
+	`|[a-z0-9](Pass|Pwd|Pw|Key|Auth|Hash|Salt|Dsn|Pem)s?($|[^a-z])`
+
+// typeAnnotations are the comments that choose the field type of one variable,
+// either inline or on the line above it, overriding the rules
+var typeAnnotations = map[string]string{
+	"op:concealed": "CONCEALED",
+	"op:text":      "STRING",
+	"op:url":       "URL",
+	"op:email":     "EMAIL",
+	"op:otp":       "OTP",
+	"op:date":      "DATE",
+}
+
+// ConcealRules decide which variables are stored as concealed fields. They can be
+// set in the project file ([conceal]) or the user config ("conceal").
+type ConcealRules struct {
+	All     bool     `json:"all,omitempty" toml:"all"`         // conceal every variable not excluded
+	Include []string `json:"include,omitempty" toml:"include"` // regexes of names to conceal, on top of the defaults
+	Exclude []string `json:"exclude,omitempty" toml:"exclude"` // regexes of names never to conceal, checked first
+
+	// DetectTypes stores values that look like URLs, emails, dates or otpauth://
+	// URIs as URL, EMAIL, DATE and OTP fields
+	DetectTypes bool `json:"detectTypes,omitempty" toml:"detect_types"`
+}
+
+// concealer applies compiled ConcealRules to variables
+type concealer struct {
+	all     bool
+	detect  bool
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+var defaultConcealer = &concealer{include: []*regexp.Regexp{regexp.MustCompile(defaultConcealPattern)}}
+
+// compile checks the patterns of the rules and adds them to the defaults
+func (r ConcealRules) compile() (*concealer, error) {
+	c := &concealer{all: r.All, detect: r.DetectTypes, include: defaultConcealer.include}
+
+	for _, pattern := range r.Include {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid conceal include pattern %q: %w", pattern, err)
+		}
+		c.include = append(c.include, re)
+	}
+	for _, pattern := range r.Exclude {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid conceal exclude pattern %q: %w", pattern, err)
+		}
+		c.exclude = append(c.exclude, re)
+	}
+
+	return c, nil
+}
+
+// fieldType returns the 1Password field type for a variable name
+func (c *concealer) fieldType(name string) string {
+	for _, re := range c.exclude {
+		if re.MatchString(name) {
+			return "STRING"
+		}
+	}
+	if c.all {
+		return "CONCEALED"
+	}
+	for _, re := range c.include {
+		if re.MatchString(name) {
+			return "CONCEALED"
+		}
+	}
+	return "STRING"
+}
+
+// valueType returns the 1Password field type for a variable. With type detection,
+// otpauth:// URIs always become OTP fields, and URLs, emails and dates become typed
+// fields unless their name is concealed.
+func (c *concealer) valueType(name, value string) string {
+	fieldType := c.fieldType(name)
+	if !c.detect {
+		return fieldType
+	}
+
+	detected := detectFieldType(value)
+	if detected == "OTP" || (detected != "" && fieldType == "STRING") {
+		return detected
+	}
+	return fieldType
+}
+
+// describe summarizes the rules for `op-dotenv config`
+func (c *concealer) describe() string {
+	desc := "names like *_KEY, *_SECRET and *_PASSWORD"
+	if c.all {
+		desc = "all variables"
+	} else if n := len(c.include) - len(defaultConcealer.include); n > 0 {
+		desc += fmt.Sprintf(" and %d include pattern(s)", n)
+	}
+	if n := len(c.exclude); n > 0 {
+		desc += fmt.Sprintf(", except %d exclude pattern(s)", n)
+	}
+	if c.detect {
+		desc += ", with type detection"
+	}
+	return desc
+}
+
+// annotation returns the comment to write after a variable so that it keeps its
+// field type, or "" if the rules already give it that type (or no annotation can)
+func (c *concealer) annotation(name, value, fieldType string) string {
+	if fieldType == c.valueType(name, value) {
+		return ""
+	}
+	for annotation, annotated := range typeAnnotations {
+		if annotated == fieldType {
+			return "# " + annotation
+		}
+	}
+	return ""
+}
+
+// keepConcealed keeps the variables concealed in 1Password concealed in an item
+// parsed from a file, unless the file annotates them with # op:text. Rules
+// that changed since they were pushed never reveal a secret.
+func keepConcealed(local, remote *onepassword.OnePasswordItem) {
+	if remote == nil {
+		return
+	}
+	concealed := make(map[string]bool)
+	for _, field := range envFields(remote) {
+		if field.Type == "CONCEALED" {
+			concealed[field.Label] = true
+		}
+	}
+
+	annotated := make(map[string]string)
+	if layout := parseLayout(local); layout != nil {
+		for _, line := range layout.Lines {
+			for _, text := range append(strings.Split(line.Above, "\n"), line.Suffix) {
+				if text = strings.TrimSpace(text); line.Key != "" && annotatedType(text) != "" {
+					annotated[line.Key] = annotatedType(text)
+				}
+			}
+		}
+	}
+
+	for i, field := range local.Fields {
+		if concealed[field.Label] && isEnvField(field) && field.Type == "STRING" && annotated[field.Label] != "STRING" {
+			local.Fields[i].Type = "CONCEALED"
+		}
+	}
+}
+
+// annotatedType returns the field type a comment asks for, or "" if it isn't an annotation
+func annotatedType(comment string) string {
+	return typeAnnotations[strings.TrimSpace(strings.TrimPrefix(comment, "#"))]
+}
@@ -8,11 +8,32 @@ import (
 
 type Config struct {
 	Projects map[string]ProjectConfig `json:"projects"`
+
+	// Conceal decides which variables are concealed, unless the project file does
+	Conceal *ConcealRules `json:"conceal,omitempty"`
+
+	// Syncs holds the base snapshot of each env file, keyed by absolute path
+	Syncs map[string]*SyncState `json:"syncs,omitempty"`
 }
 
 type ProjectConfig struct {
-	Vault string `json:"vault"`
-	Item  string `json:"item"`
+	Vault        string                       `json:"vault"`
+	Account      string                       `json:"account,omitempty"`
+	Item         string                       `json:"item"`
+	Environments map[string]EnvironmentConfig `json:"environments,omitempty"`
+
+	// VaultIDs holds the ID each vault name resolved to, so that it keeps
+	// meaning the same vault when another one gets the same name
+	VaultIDs map[string]string `json:"vaultIds,omitempty"`
+}
+
+// EnvironmentConfig maps one environment (dev, staging, prod...) of a project
+// to its own env file and item. It is used by both the user config and the project file.
+type EnvironmentConfig struct {
+	Vault   string `json:"vault,omitempty" toml:"vault"`
+	Account string `json:"account,omitempty" toml:"account"`
+	Item    string `json:"item,omitempty" toml:"item"`
+	File    string `json:"file,omitempty" toml:"file"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -48,19 +69,27 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	// Ensure config directory exists
+	// Ensure config directory exists. Only the user may read it: the sync
+	// states hold hashes of secret values along with their key.
 	configDir := filepath.Dir(configPath)
-	err = os.MkdirAll(configDir, 0755)
+	err = os.MkdirAll(configDir, 0700)
 	if err != nil {
 		return err
 	}
+	if err := os.Chmod(configDir, 0700); err != nil {
+		return err
+	}
 
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return err
+	}
+	// Files written by older versions were readable by everyone
+	return os.Chmod(configPath, 0600)
 }
 
 func (c *Config) GetVault(projectPath, defaultVault string) string {
@@ -87,6 +116,17 @@ func (c *Config) SetVault(projectPath, vault string) {
 	c.Projects[projectPath] = project
 }
 
+// SetAccount remembers the 1Password account the vault of a project belongs to
+func (c *Config) SetAccount(projectPath, account string) {
+	if c.Projects == nil {
+		c.Projects = make(map[string]ProjectConfig)
+	}
+
+	project := c.Projects[projectPath]
+	project.Account = account
+	c.Projects[projectPath] = project
+}
+
 func (c *Config) SetItem(projectPath, item string) {
 	if c.Projects == nil {
 		c.Projects = make(map[string]ProjectConfig)
@@ -97,6 +137,54 @@ func (c *Config) SetItem(projectPath, item string) {
 	c.Projects[projectPath] = project
 }
 
+func (c *Config) SetEnvironment(projectPath, env, vault, account, item string) {
+	if c.Projects == nil {
+		c.Projects = make(map[string]ProjectConfig)
+	}
+
+	project := c.Projects[projectPath]
+	if project.Environments == nil {
+		project.Environments = make(map[string]EnvironmentConfig)
+	}
+	environment := project.Environments[env]
+	environment.Vault = vault
+	environment.Account = account
+	environment.Item = item
+	project.Environments[env] = environment
+	c.Projects[projectPath] = project
+}
+
+// SetVaultID remembers the ID a vault name (or name@account) resolved to
+func (c *Config) SetVaultID(projectPath, vault, id string) {
+	if c.Projects == nil {
+		c.Projects = make(map[string]ProjectConfig)
+	}
+
+	project := c.Projects[projectPath]
+	if project.VaultIDs == nil {
+		project.VaultIDs = make(map[string]string)
+	}
+	project.VaultIDs[vault] = id
+	c.Projects[projectPath] = project
+}
+
+// GetSync returns the base snapshot of an env file, or nil if it was last
+// synced with another item (or never)
+func (c *Config) GetSync(filePath, vault, item string) *SyncState {
+	state := c.Syncs[filePath]
+	if state == nil || state.Vault != vault || state.Item != item {
+		return nil
+	}
+	return state
+}
+
+func (c *Config) SetSync(filePath string, state *SyncState) {
+	if c.Syncs == nil {
+		c.Syncs = make(map[string]*SyncState)
+	}
+	c.Syncs[filePath] = state
+}
+
 func getConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
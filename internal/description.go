@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// Descriptions of variables, the comment lines above them in a .env file, are
+// stored in a section of their own under the name of the variable
+const descriptionSection = "op-dotenv descriptions"
+
+// descriptionField stores the description of a variable
+func descriptionField(label, description string) onepassword.OnePasswordField {
+	return onepassword.OnePasswordField{
+		Type:    "STRING",
+		Label:   label,
+		Value:   description,
+		Section: map[string]interface{}{"label": descriptionSection},
+	}
+}
+
+// descriptionKey indexes the description of a variable among the variables of
+// an item, see mergeFields. No variable name starts with a #.
+func descriptionKey(label string) string {
+	return "#" + label
+}
+
+// isDescriptionField reports whether a field holds the description of a variable
+func isDescriptionField(field onepassword.OnePasswordField) bool {
+	return fieldSection(field) == descriptionSection
+}
+
+// itemDescriptions maps the variables of an item to their description
+func itemDescriptions(item *onepassword.OnePasswordItem) map[string]string {
+	descriptions := make(map[string]string)
+	for _, field := range item.Fields {
+		if isDescriptionField(field) && field.Value != "" {
+			descriptions[field.Label] = field.Value
+		}
+	}
+	return descriptions
+}
+
+// descriptionFields returns the description fields of an item, for the
+// variables it still has
+func descriptionFields(item *onepassword.OnePasswordItem) []onepassword.OnePasswordField {
+	descriptions := itemDescriptions(item)
+	var fields []onepassword.OnePasswordField
+	for _, field := range envFields(item) {
+		if description, ok := descriptions[field.Label]; ok {
+			fields = append(fields, descriptionField(field.Label, description))
+		}
+	}
+	return fields
+}
+
+// descriptionChanges lists the changes needed to turn the descriptions of item
+// "from" into those of item "to"
+func descriptionChanges(from, to *onepassword.OnePasswordItem) []FieldChange {
+	old := make(map[string]onepassword.OnePasswordField)
+	for _, field := range from.Fields {
+		if isDescriptionField(field) {
+			old[field.Label] = field
+		}
+	}
+
+	var changes []FieldChange
+	for _, field := range descriptionFields(to) {
+		previous, exists := old[field.Label]
+		switch {
+		case !exists:
+			changes = append(changes, FieldChange{Kind: FieldAdded, Label: field.Label, New: field})
+		case previous.Value != field.Value:
+			changes = append(changes, FieldChange{Kind: FieldChanged, Label: field.Label, Old: previous, New: field})
+		}
+		delete(old, field.Label)
+	}
+	for _, field := range from.Fields {
+		if _, removed := old[field.Label]; removed && isDescriptionField(field) {
+			changes = append(changes, FieldChange{Kind: FieldRemoved, Label: field.Label, Old: field})
+		}
+	}
+	return changes
+}
+
+// describedAs returns the description that comment lines hold
+func describedAs(lines []string) string {
+	text := make([]string, len(lines))
+	for i, line := range lines {
+		text[i] = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#"))
+	}
+	return strings.Join(text, "\n")
+}
+
+// descriptionComment formats a description as the comment lines above a variable
+func descriptionComment(description string) string {
+	if description == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(description, "\n") {
+		if line == "" {
+			b.WriteString("#\n")
+		} else {
+			b.WriteString("# " + line + "\n")
+		}
+	}
+	return b.String()
+}
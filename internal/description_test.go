@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// sectionsAndDescriptions maps the variables of an item to their section and description
+func sectionsAndDescriptions(item *onepassword.OnePasswordItem) map[string][2]string {
+	descriptions := itemDescriptions(item)
+	got := make(map[string][2]string)
+	for _, field := range envFields(item) {
+		got[field.Label] = [2]string{fieldSection(field), descriptions[field.Label]}
+	}
+	return got
+}
+
+func TestParseDescriptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string][2]string
+	}{
+		{
+			name: "comments after a blank line start sections",
+			content: `APP_NAME=demo
+# Stripe live key, rotate quarterly
+STRIPE_KEY=sk_live
+# op:concealed
+# Webhook secret
+#   from the dashboard
+STRIPE_WEBHOOK=whsec
+
+# Database
+# Primary host
+DB_HOST=db
+DB_PORT=5432
+`,
+			want: map[string][2]string{
+				"APP_NAME":       {"", ""},
+				"STRIPE_KEY":     {"", "Stripe live key, rotate quarterly"},
+				"STRIPE_WEBHOOK": {"", "Webhook secret\nfrom the dashboard"},
+				"DB_HOST":        {"Database", "Primary host"},
+				"DB_PORT":        {"Database", ""},
+			},
+		},
+		{
+			name: "## lines start sections",
+			content: `# Stripe live key
+STRIPE_KEY=sk_live
+
+## Database
+# Primary host
+DB_HOST=db
+
+# Replica, read only
+DB_REPLICA=replica
+
+# A note about nothing
+
+##
+LOOSE=value
+`,
+			want: map[string][2]string{
+				"STRIPE_KEY": {"", "Stripe live key"},
+				"DB_HOST":    {"Database", "Primary host"},
+				"DB_REPLICA": {"Database", "Replica, read only"},
+				"LOOSE":      {"", ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := ParseEnvFileToItem(writeEnvFile(t, tt.content), "test-item")
+			if err != nil {
+				t.Fatalf("ParseEnvFileToItem failed: %v", err)
+			}
+			got := sectionsAndDescriptions(item)
+			if len(got) != len(tt.want) {
+				t.Errorf("Expected %d variables, got %v", len(tt.want), got)
+			}
+			for label, want := range tt.want {
+				if got[label] != want {
+					t.Errorf("%s: expected section and description %q, got %q", label, want, got[label])
+				}
+			}
+
+			// Pulled back, the file is the same
+			if written := rewrite(t, tt.content, nil); written != tt.content {
+				t.Errorf("Round trip changed the file:\n%s\nwant:\n%s", written, tt.content)
+			}
+		})
+	}
+}
+
+func TestWriteDescriptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []onepassword.OnePasswordField
+		want   string
+	}{
+		{
+			name: "sections start with # lines",
+			fields: []onepassword.OnePasswordField{
+				{Type: "STRING", Label: "APP_NAME", Value: "demo"},
+				{Type: "STRING", Label: "DB_HOST", Value: "db", Section: map[string]interface{}{"label": "Database"}},
+				descriptionField("DB_HOST", "Primary host\nread-write"),
+			},
+			want: `APP_NAME='demo'
+
+# Database
+# Primary host
+# read-write
+DB_HOST='db'
+`,
+		},
+		{
+			name: "a description at the top needs ## sections",
+			fields: []onepassword.OnePasswordField{
+				{Type: "STRING", Label: "APP_NAME", Value: "demo"},
+				descriptionField("APP_NAME", "Shown in the title bar"),
+				{Type: "STRING", Label: "DB_HOST", Value: "db", Section: map[string]interface{}{"label": "Database"}},
+			},
+			want: `# Shown in the title bar
+APP_NAME='demo'
+
+## Database
+DB_HOST='db'
+`,
+		},
+		{
+			name: "without sections a bare ## comes first",
+			fields: []onepassword.OnePasswordField{
+				{Type: "STRING", Label: "APP_NAME", Value: "demo"},
+				descriptionField("APP_NAME", "Shown in the title bar"),
+			},
+			want: `##
+# Shown in the title bar
+APP_NAME='demo'
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &onepassword.OnePasswordItem{Title: "test-item", Fields: tt.fields}
+			envFile := filepath.Join(t.TempDir(), ".env")
+			if err := WriteItemToEnvFile(envFile, item); err != nil {
+				t.Fatalf("WriteItemToEnvFile failed: %v", err)
+			}
+			written, _ := os.ReadFile(envFile)
+			if string(written) != tt.want {
+				t.Errorf("Unexpected output:\n%s\nwant:\n%s", written, tt.want)
+			}
+
+			parsed, err := ParseEnvFileToItem(envFile, "test-item")
+			if err != nil {
+				t.Fatalf("ParseEnvFileToItem failed: %v", err)
+			}
+			if got, want := sectionsAndDescriptions(parsed), sectionsAndDescriptions(item); len(got) != len(want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			} else {
+				for label := range want {
+					if got[label] != want[label] {
+						t.Errorf("%s: expected %q, got %q", label, want[label], got[label])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLayoutDescriptions(t *testing.T) {
+	content := `A=1
+# Old description
+# op:concealed
+B=2
+
+# Section
+C=3
+`
+	describe := func(descriptions map[string]string) func(item *onepassword.OnePasswordItem) {
+		return func(item *onepassword.OnePasswordItem) {
+			var fields []onepassword.OnePasswordField
+			for _, field := range item.Fields {
+				if !isDescriptionField(field) {
+					fields = append(fields, field)
+				}
+			}
+			for label, description := range descriptions {
+				fields = append(fields, descriptionField(label, description))
+			}
+			item.Fields = fields
+		}
+	}
+
+	written := rewrite(t, content, describe(map[string]string{"B": "New description", "C": "Third"}))
+	want := `A=1
+# New description
+# op:concealed
+B=2
+
+# Section
+# Third
+C=3
+`
+	if written != want {
+		t.Errorf("Changed descriptions should replace the comments above, got:\n%s\nwant:\n%s", written, want)
+	}
+
+	written = rewrite(t, content, describe(map[string]string{"A": "First"}))
+	want = `# First
+A=1
+# op:concealed
+B=2
+
+## Section
+C=3
+`
+	if written != want {
+		t.Errorf("A description at the top should switch to ## sections, got:\n%s\nwant:\n%s", written, want)
+	}
+	if !strings.Contains(rewrite(t, written, nil), "# First\nA=1") {
+		t.Errorf("The description should survive another round trip")
+	}
+}
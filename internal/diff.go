@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// ChangeKind describes how a field differs between two items
+type ChangeKind string
+
+const (
+	FieldAdded   ChangeKind = "added"
+	FieldRemoved ChangeKind = "removed"
+	FieldChanged ChangeKind = "changed"
+)
+
+// FieldChange is a single difference between two items.
+// Fields are matched by label, since labels are the variable names.
+type FieldChange struct {
+	Kind  ChangeKind
+	Label string
+	Old   onepassword.OnePasswordField // zero for added fields
+	New   onepassword.OnePasswordField // zero for removed fields
+}
+
+// SectionChanged reports whether a changed field moved to another section
+func (c FieldChange) SectionChanged() bool {
+	return c.Kind == FieldChanged && fieldSection(c.Old) != fieldSection(c.New)
+}
+
+// DiffItems lists the changes needed to turn item "from" into item "to".
+// Changes follow the field order of "to", with removals last.
+func DiffItems(from, to *onepassword.OnePasswordItem) []FieldChange {
+	oldFields := make(map[string]onepassword.OnePasswordField)
+	for _, field := range envFields(from) {
+		oldFields[field.Label] = field
+	}
+
+	var changes []FieldChange
+	seen := make(map[string]bool)
+
+	for _, field := range envFields(to) {
+		seen[field.Label] = true
+
+		old, exists := oldFields[field.Label]
+		if !exists {
+			changes = append(changes, FieldChange{Kind: FieldAdded, Label: field.Label, New: field})
+			continue
+		}
+
+		if old.Value != field.Value || old.Type != field.Type || fieldSection(old) != fieldSection(field) {
+			changes = append(changes, FieldChange{Kind: FieldChanged, Label: field.Label, Old: old, New: field})
+		}
+	}
+
+	for _, field := range envFields(from) {
+		if !seen[field.Label] {
+			changes = append(changes, FieldChange{Kind: FieldRemoved, Label: field.Label, Old: field})
+		}
+	}
+
+	// Notes are a built-in field that always exists, so they can only change
+	oldNotes, newNotes := itemNotes(from), itemNotes(to)
+	if oldNotes.Value != newNotes.Value {
+		changes = append(changes, FieldChange{Kind: FieldChanged, Label: "notesPlain", Old: oldNotes, New: newNotes})
+	}
+
+	return changes
+}
+
+// envFields returns the fields of an item that hold variables
+func envFields(item *onepassword.OnePasswordItem) []onepassword.OnePasswordField {
+	var fields []onepassword.OnePasswordField
+	for _, field := range item.Fields {
+		if isEnvField(field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// isEnvField reports whether a field holds a variable. Empty variables count,
+// but empty built-in fields (like the password field of a Password item), the
+// layout of the .env file and the descriptions of variables don't.
+func isEnvField(field onepassword.OnePasswordField) bool {
+	if field.ID == "notesPlain" || field.Label == "" || isLayoutField(field) || isReferencesField(field) || isDescriptionField(field) {
+		return false
+	}
+	return field.Purpose == "" || field.Value != ""
+}
+
+// itemNotes returns the notes field of an item, or an empty one
+func itemNotes(item *onepassword.OnePasswordItem) onepassword.OnePasswordField {
+	for _, field := range item.Fields {
+		if field.ID == "notesPlain" {
+			return field
+		}
+	}
+	return onepassword.OnePasswordField{ID: "notesPlain", Type: "STRING", Label: "notesPlain"}
+}
+
+// fieldSection returns the section label of a field, or "" for no section
+func fieldSection(field onepassword.OnePasswordField) string {
+	if field.Section == nil {
+		return ""
+	}
+	label, _ := field.Section["label"].(string)
+	return label
+}
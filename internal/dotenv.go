@@ -0,0 +1,268 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// envEntryKind identifies what a logical line of a .env file holds
+type envEntryKind int
+
+const (
+	entryBlank envEntryKind = iota
+	entryComment
+	entryVariable
+)
+
+// envEntry is one logical line of a .env file. Quoted values may span
+// several physical lines, so Line is where the entry starts.
+type envEntry struct {
+	Kind    envEntryKind
+	Line    int
+	Key     string
+	Value   string
+	Export  bool   // the variable was written as `export KEY=value`
+	Comment string // full text of a comment line, or the inline comment after a value
+
+	// How the entry was written, for layouts (see envLayout)
+	Raw     string // a blank or comment line as written
+	Prefix  string // text before the value, like `export KEY=`
+	Quote   string // quote around the value, "" if unquoted
+	Escapes string // optional escapes used in a double-quoted value, see writeDoubleQuoted
+	Suffix  string // text after the value on its last line, like ` # comment`
+}
+
+// LineError describes a single line of a .env file that couldn't be parsed
+type LineError struct {
+	Line    int
+	Message string
+}
+
+// ParseError lists every line of a .env file that couldn't be parsed
+type ParseError struct {
+	Errors []LineError
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if len(e.Errors) == 1 {
+		b.WriteString("1 invalid line:")
+	} else {
+		fmt.Fprintf(&b, "%d invalid lines:", len(e.Errors))
+	}
+	for _, lineErr := range e.Errors {
+		fmt.Fprintf(&b, "\n  line %d: %s", lineErr.Line, lineErr.Message)
+	}
+	return b.String()
+}
+
+// lexDotenv splits .env content into entries. It accepts the syntax understood
+// by python-dotenv and godotenv:
+//
+//	KEY=value                 unquoted, surrounding whitespace trimmed
+//	export KEY = value        optional export prefix and spaces around =
+//	KEY=value # comment       inline comments need whitespace before the #
+//	KEY='literal $value'      single quotes are taken literally
+//	KEY="line\nbreak \"q\""   double quotes support \n \r \t \" \\ \$ escapes
+//	KEY="multi               quoted values may span several lines
+//	line"
+//	KEY=${A}:${B:-default}    references are kept as written, see expandValue
+//
+// A literal ${ (single-quoted, or \${ in double quotes) is kept as $${ until it
+// is stored, see storedValue.
+//
+// Every invalid line, including a variable set again, is reported in the
+// returned *ParseError.
+func lexDotenv(content string) ([]envEntry, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+
+	// A trailing newline doesn't start another line
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var entries []envEntry
+	var errs []LineError
+	seen := make(map[string]int) // line each variable was first set on
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		switch {
+		case line == "":
+			entries = append(entries, envEntry{Kind: entryBlank, Line: i + 1, Raw: lines[i]})
+		case strings.HasPrefix(line, "#"):
+			entries = append(entries, envEntry{Kind: entryComment, Line: i + 1, Comment: line, Raw: lines[i]})
+		default:
+			entry, next, err := lexVariable(lines, i)
+			if first, ok := seen[entry.Key]; ok && err == nil {
+				err = fmt.Errorf("%s is set more than once (first on line %d)", entry.Key, first)
+			}
+			if err != nil {
+				errs = append(errs, LineError{Line: i + 1, Message: err.Error()})
+			} else {
+				seen[entry.Key] = i + 1
+				entries = append(entries, entry)
+			}
+			i = next - 1
+		}
+	}
+
+	if len(errs) > 0 {
+		return entries, &ParseError{Errors: errs}
+	}
+	return entries, nil
+}
+
+// lexVariable parses the assignment starting at lines[start]. It returns the
+// entry and the index of the first line after it.
+func lexVariable(lines []string, start int) (envEntry, int, error) {
+	entry := envEntry{Kind: entryVariable, Line: start + 1}
+	s := strings.TrimLeft(lines[start], " \t")
+
+	if rest, ok := strings.CutPrefix(s, "export"); ok && len(rest) > 0 && (rest[0] == ' ' || rest[0] == '\t') {
+		entry.Export = true
+		s = strings.TrimLeft(rest, " \t")
+	}
+
+	// Key
+	end := 0
+	for end < len(s) && isKeyChar(s[end], end == 0) {
+		end++
+	}
+	if end == 0 {
+		return entry, start + 1, fmt.Errorf("invalid variable name in %q", strings.TrimSpace(lines[start]))
+	}
+	entry.Key = s[:end]
+	s = strings.TrimLeft(s[end:], " \t")
+
+	if !strings.HasPrefix(s, "=") {
+		return entry, start + 1, fmt.Errorf("expected '=' after %q", entry.Key)
+	}
+	s = strings.TrimLeft(s[1:], " \t")
+
+	entry.Prefix = lines[start][:len(lines[start])-len(s)]
+
+	// Unquoted value, ending at an inline comment
+	if s == "" || (s[0] != '\'' && s[0] != '"') {
+		value := s
+		for i := 0; i < len(s); i++ {
+			if s[i] == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+				value = s[:i]
+				entry.Comment = strings.TrimSpace(s[i:])
+				break
+			}
+		}
+		entry.Value = strings.TrimSpace(value)
+		entry.Suffix = s[strings.Index(s, entry.Value)+len(entry.Value):]
+		return entry, start + 1, nil
+	}
+
+	// Quoted value, which may continue on the following lines
+	quote := s[0]
+	entry.Quote = string(quote)
+	rest := s[1:]
+	if start+1 < len(lines) {
+		rest += "\n" + strings.Join(lines[start+1:], "\n")
+	}
+
+	var value strings.Builder
+	escapes := make(map[byte]bool)
+	unknownEscape, escapedBackslash := false, false
+	closed := -1
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		if c == quote {
+			closed = i
+			break
+		}
+		if c == '\\' && quote == '"' && i+1 < len(rest) {
+			i++
+			switch rest[i] {
+			case 'n':
+				value.WriteByte('\n')
+				escapes['n'] = true
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+				escapes['t'] = true
+			case '$':
+				value.WriteString(literalDollar(rest, i))
+				escapes['$'] = true
+			case '\'':
+				value.WriteByte(rest[i])
+				escapes['\''] = true
+			case '"', '\\':
+				value.WriteByte(rest[i])
+				escapedBackslash = escapedBackslash || rest[i] == '\\'
+			default:
+				// Unknown escapes are kept as written
+				value.WriteByte('\\')
+				value.WriteByte(rest[i])
+				unknownEscape = true
+			}
+			continue
+		}
+		if c == '$' && quote == '\'' {
+			value.WriteString(literalDollar(rest, i))
+			continue
+		}
+		value.WriteByte(c)
+	}
+
+	if closed < 0 {
+		kind := "double"
+		if quote == '\'' {
+			kind = "single"
+		}
+		return entry, len(lines), fmt.Errorf("unterminated %s-quoted value for %q", kind, entry.Key)
+	}
+
+	next := start + 1 + strings.Count(rest[:closed], "\n")
+	tail := rest[closed+1:]
+	if newline := strings.IndexByte(tail, '\n'); newline >= 0 {
+		tail = tail[:newline]
+	}
+	entry.Suffix = tail
+	for _, c := range []byte("nt$'") {
+		if escapes[c] {
+			entry.Escapes += string(c)
+		}
+	}
+	// Backslashes are written bare again if none was escaped, see writeDoubleQuoted
+	if unknownEscape && !escapedBackslash {
+		entry.Escapes += `\`
+	}
+	tail = strings.TrimSpace(tail)
+
+	if tail != "" && !strings.HasPrefix(tail, "#") {
+		return entry, next, fmt.Errorf("unexpected %q after quoted value for %q", tail, entry.Key)
+	}
+
+	entry.Value = value.String()
+	entry.Comment = tail
+	return entry, next, nil
+}
+
+// literalDollar returns how the literal $ at s[i] is kept in a value: as $$ when
+// it starts ${, so that it can't be mistaken for a reference later
+func literalDollar(s string, i int) string {
+	if i+1 < len(s) && s[i+1] == '{' {
+		return "$$"
+	}
+	return "$"
+}
+
+// isKeyChar reports whether c may appear in a variable name
+func isKeyChar(c byte, first bool) bool {
+	switch {
+	case c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+		return true
+	case c >= '0' && c <= '9', c == '.', c == '-':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// Formatter writes the variables of an item in a file format other than dotenv
+type Formatter interface {
+	Format(item *onepassword.OnePasswordItem) ([]byte, error)
+}
+
+// formatters are the formats of `op-dotenv export --format`
+var formatters = map[string]Formatter{
+	"json":    jsonFormatter{},
+	"yaml":    yamlFormatter{},
+	"shell":   shellFormatter{},
+	"docker":  dockerFormatter{},
+	"systemd": systemdFormatter{},
+	"k8s":     k8sSecretFormatter{},
+}
+
+// FormatNames lists the export formats, sorted
+func FormatNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export writes the variables of a 1Password item in the given format to outPath,
+// or stdout when outPath is empty, with their references expanded
+func (a *App) Export(format, outPath, vault, item string) error {
+	formatter, ok := formatters[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(FormatNames(), ", "))
+	}
+
+	t, opItem, err := a.fetchItem(vault, item)
+	if err != nil {
+		return err
+	}
+
+	// Other tools get the values references point to, like processes do
+	opItem, err = a.expandItem(opItem)
+	if err != nil {
+		return err
+	}
+
+	data, err := formatter.Format(opItem)
+	if err != nil {
+		return err
+	}
+
+	if outPath == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(outPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outPath, err)
+	}
+	ShowSuccess("Exported", t.Vault+"/"+t.Item, outPath+" as "+format)
+	return nil
+}
+
+// jsonFormatter writes a flat object of variables, in item order
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(item *onepassword.OnePasswordItem) ([]byte, error) {
+	fields := envFields(item)
+	if len(fields) == 0 {
+		return []byte("{}\n"), nil
+	}
+
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, field := range fields {
+		fmt.Fprintf(&b, "  %s: %s", jsonString(field.Label), jsonString(field.Value))
+		if i < len(fields)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	return b.Bytes(), nil
+}
+
+// yamlFormatter writes a flat mapping of variables, in item order
+type yamlFormatter struct{}
+
+func (yamlFormatter) Format(item *onepassword.OnePasswordItem) ([]byte, error) {
+	var b bytes.Buffer
+	writeYAMLMapping(&b, "", envFields(item), func(value string) string { return jsonString(value) })
+	if b.Len() == 0 {
+		return []byte("{}\n"), nil
+	}
+	return b.Bytes(), nil
+}
+
+// shellFormatter writes POSIX `export KEY='value'` lines to be sourced
+type shellFormatter struct{}
+
+func (shellFormatter) Format(item *onepassword.OnePasswordItem) ([]byte, error) {
+	var b bytes.Buffer
+	for _, field := range envFields(item) {
+		if !shellNamePattern.MatchString(field.Label) {
+			return nil, fmt.Errorf("%s is not a valid shell variable name", field.Label)
+		}
+		fmt.Fprintf(&b, "export %s='%s'\n", field.Label, strings.ReplaceAll(field.Value, "'", `'\''`))
+	}
+	return b.Bytes(), nil
+}
+
+// dockerFormatter writes KEY=value lines for `docker run --env-file`, which takes
+// values literally and has no way to write a line break
+type dockerFormatter struct{}
+
+func (dockerFormatter) Format(item *onepassword.OnePasswordItem) ([]byte, error) {
+	var b bytes.Buffer
+	for _, field := range envFields(item) {
+		if strings.ContainsAny(field.Value, "\n\r") {
+			return nil, fmt.Errorf("%s spans several lines, which Docker env files can't hold", field.Label)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", field.Label, field.Value)
+	}
+	return b.Bytes(), nil
+}
+
+// systemdFormatter writes KEY="value" lines for an EnvironmentFile= of a unit.
+// Double quotes may span lines there, and only \, ", $ and ` can be escaped.
+type systemdFormatter struct{}
+
+func (systemdFormatter) Format(item *onepassword.OnePasswordItem) ([]byte, error) {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+	var b bytes.Buffer
+	for _, field := range envFields(item) {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", field.Label, escaper.Replace(field.Value))
+	}
+	return b.Bytes(), nil
+}
+
+// k8sSecretFormatter writes a Kubernetes Secret manifest named after the item,
+// with the variables base64-encoded as data
+type k8sSecretFormatter struct{}
+
+func (k8sSecretFormatter) Format(item *onepassword.OnePasswordItem) ([]byte, error) {
+	fields := envFields(item)
+	for _, field := range fields {
+		if !k8sKeyPattern.MatchString(field.Label) {
+			return nil, fmt.Errorf("%s is not a valid Kubernetes Secret key", field.Label)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("apiVersion: v1\nkind: Secret\nmetadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", k8sName(item.Title))
+	b.WriteString("type: Opaque\n")
+	if len(fields) == 0 {
+		b.WriteString("data: {}\n")
+		return b.Bytes(), nil
+	}
+	b.WriteString("data:\n")
+	writeYAMLMapping(&b, "  ", fields, func(value string) string {
+		if value == "" {
+			return `""`
+		}
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	})
+	return b.Bytes(), nil
+}
+
+var (
+	shellNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	k8sKeyPattern    = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+	k8sInvalidChars  = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+// writeYAMLMapping writes one `key: value` line per field, quoting keys that
+// aren't plain names
+func writeYAMLMapping(b *bytes.Buffer, indent string, fields []onepassword.OnePasswordField, value func(string) string) {
+	for _, field := range fields {
+		key := field.Label
+		if !shellNamePattern.MatchString(key) {
+			key = jsonString(key)
+		}
+		fmt.Fprintf(b, "%s%s: %s\n", indent, key, value(field.Value))
+	}
+}
+
+// jsonString quotes s as a JSON string, which YAML reads as a double-quoted scalar
+func jsonString(s string) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// k8sName turns an item title into a valid object name, like myapp/services/api
+// into myapp-services-api
+func k8sName(title string) string {
+	name := strings.Trim(k8sInvalidChars.ReplaceAllString(strings.ToLower(title), "-"), "-.")
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-.")
+	}
+	if name == "" {
+		return "secret"
+	}
+	return name
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// exportItem holds values that need quoting or escaping in most formats
+var exportItem = &onepassword.OnePasswordItem{
+	Title: "myapp/API Server",
+	Fields: []onepassword.OnePasswordField{
+		{ID: "notesPlain", Purpose: "NOTES", Label: "notesPlain", Value: "# Database"},
+		{ID: "a", Type: "STRING", Label: "DATABASE_URL", Value: "postgres://user:p@ss@localhost:5432/app?sslmode=disable"},
+		{ID: "b", Type: "CONCEALED", Label: "API_KEY", Value: `it's "quoted" $HOME` + "`id`"},
+		{ID: "c", Type: "STRING", Label: "EMPTY", Value: ""},
+		{ID: "d", Type: "STRING", Label: "GREETING", Value: "héllo wörld <&>"},
+	},
+}
+
+func TestExportGolden(t *testing.T) {
+	for _, name := range FormatNames() {
+		t.Run(name, func(t *testing.T) {
+			got, err := formatters[name].Format(exportItem)
+			if err != nil {
+				t.Fatalf("Format failed: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "export", name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Unexpected output:\n%s\nexpected:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestExportRejectsUnrepresentableValues(t *testing.T) {
+	multiline := &onepassword.OnePasswordItem{
+		Title:  "myapp",
+		Fields: []onepassword.OnePasswordField{{ID: "a", Label: "CERT", Value: "line1\nline2"}},
+	}
+	if _, err := formatters["docker"].Format(multiline); err == nil {
+		t.Error("Expected docker to reject a multi-line value")
+	}
+	if _, err := formatters["systemd"].Format(multiline); err != nil {
+		t.Errorf("Expected systemd to escape a multi-line value: %v", err)
+	}
+
+	badName := &onepassword.OnePasswordItem{
+		Title:  "myapp",
+		Fields: []onepassword.OnePasswordField{{ID: "a", Label: "my key", Value: "x"}},
+	}
+	for _, name := range []string{"shell", "k8s"} {
+		if _, err := formatters[name].Format(badName); err == nil {
+			t.Errorf("Expected %s to reject the label %q", name, "my key")
+		}
+	}
+}
+
+func TestExportWritesFile(t *testing.T) {
+	app, _ := newTestApp(t, "Environments")
+	if err := app.Push(writeEnvFile(t, "API_KEY=secret123\nREDIS_HOST=localhost"), "Environments", "myapp", false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "env.json")
+	if err := app.Export("json", outPath, "Environments", "myapp"); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	content, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := "{\n  \"API_KEY\": \"secret123\",\n  \"REDIS_HOST\": \"localhost\"\n}\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", content, expected)
+	}
+
+	// References are expanded, and literals lose their escape
+	envFile := writeEnvFile(t, "USER_NAME=app\nURL=x://${USER_NAME}\nLIT='cost ${notref}'")
+	if err := app.Push(envFile, "Environments", "refs", false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if err := app.Export("docker", outPath, "Environments", "refs"); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	content, _ = os.ReadFile(outPath)
+	if !strings.Contains(string(content), "URL=x://app\n") || !strings.Contains(string(content), "LIT=cost ${notref}\n") {
+		t.Errorf("Export should expand references and literals, got:\n%s", content)
+	}
+
+	err = app.Export("toml", outPath, "Environments", "myapp")
+	if err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("Expected an unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"net/mail"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// dateLayout is how DATE fields are written to .env files
+const dateLayout = "2006-01-02"
+
+// detectFieldType returns the typed field a value looks like, or "" for none
+func detectFieldType(value string) string {
+	switch {
+	case isOTPURI(value):
+		return "OTP"
+	case isWebURL(value):
+		return "URL"
+	case isEmail(value):
+		return "EMAIL"
+	case isDate(value):
+		return "DATE"
+	}
+	return ""
+}
+
+func isOTPURI(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.Scheme == "otpauth" && u.Query().Get("secret") != ""
+}
+
+// isWebURL reports whether value is an http(s) URL. URLs carrying a password
+// aren't, since URL fields aren't concealed.
+func isWebURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	_, hasPassword := u.User.Password()
+	return !hasPassword
+}
+
+func isEmail(value string) bool {
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value
+}
+
+func isDate(value string) bool {
+	_, err := time.Parse(dateLayout, value)
+	return err == nil
+}
+
+// normalizeFields converts values that 1Password returns in another form than
+// .env files hold, so that items compare equal after a round trip. DATE fields
+// come back as Unix timestamps.
+func normalizeFields(item *onepassword.OnePasswordItem) {
+	for i, field := range item.Fields {
+		if field.Type != "DATE" {
+			continue
+		}
+		if seconds, err := strconv.ParseInt(field.Value, 10, 64); err == nil {
+			item.Fields[i].Value = time.Unix(seconds, 0).UTC().Format(dateLayout)
+		}
+	}
+}
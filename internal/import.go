@@ -0,0 +1,527 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+	"gopkg.in/yaml.v3"
+)
+
+// Importer reads the variables of a file in a format other than dotenv, in
+// file order. Nested keys are returned with the path to them as section.
+type Importer interface {
+	Import(data []byte) ([]ImportedVariable, error)
+}
+
+// ImportedVariable is a variable read by an Importer
+type ImportedVariable struct {
+	Section string
+	Key     string
+	Value   string
+}
+
+// importers are the formats push reads besides dotenv
+var importers = map[string]Importer{
+	"json":    jsonImporter{},
+	"yaml":    yamlImporter{},
+	"shell":   shellImporter{},
+	"compose": composeImporter{},
+}
+
+// ImportFormatNames lists the formats push reads, sorted
+func ImportFormatNames() []string {
+	names := []string{"dotenv"}
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetImportFormat makes push and diff read env files in the given format
+// instead of telling it from the file name
+func (a *App) SetImportFormat(format string) error {
+	if _, ok := importers[format]; !ok && format != "dotenv" && format != "" {
+		return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(ImportFormatNames(), ", "))
+	}
+	a.format = format
+	return nil
+}
+
+// fileFormat returns the format of an env file: the one given, or else the one
+// its name suggests, like yaml for values.yml or compose for docker-compose.yml
+func fileFormat(filePath, format string) string {
+	if format != "" {
+		return format
+	}
+
+	name := strings.ToLower(filepath.Base(filePath))
+	switch filepath.Ext(name) {
+	case ".json":
+		return "json"
+	case ".yml", ".yaml":
+		if strings.HasPrefix(name, "compose.") || strings.HasPrefix(name, "docker-compose") {
+			return "compose"
+		}
+		return "yaml"
+	case ".sh":
+		return "shell"
+	}
+	return "dotenv"
+}
+
+// parseFile reads an env file in its format into an item. Only dotenv files
+// carry notes and type annotations, other formats get the concealment rules.
+func parseFile(filePath, itemTitle, format string, conceal *concealer) (*onepassword.OnePasswordItem, error) {
+	importer, ok := importers[fileFormat(filePath, format)]
+	if !ok {
+		return parseEnvFile(filePath, itemTitle, conceal)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	variables, err := importer.Import(data)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &onepassword.OnePasswordItem{
+		Title:  itemTitle,
+		Fields: []onepassword.OnePasswordField{},
+	}
+	seen := make(map[string]string)
+	for _, variable := range variables {
+		if section, ok := seen[variable.Key]; ok {
+			return nil, fmt.Errorf("%s is set more than once (in %s)", variable.Key, describeSections(section, variable.Section))
+		}
+		seen[variable.Key] = variable.Section
+
+		field := onepassword.OnePasswordField{
+			Type:  conceal.valueType(variable.Key, variable.Value),
+			Label: variable.Key,
+			Value: variable.Value,
+		}
+		if variable.Section != "" {
+			field.Section = map[string]interface{}{
+				"label": variable.Section,
+			}
+		}
+		item.Fields = append(item.Fields, field)
+	}
+	return item, nil
+}
+
+// describeSections names two sections for an error message
+func describeSections(first, second string) string {
+	name := func(section string) string {
+		if section == "" {
+			return "the top level"
+		}
+		return "section " + section
+	}
+	return name(first) + " and " + name(second)
+}
+
+// jsonImporter reads an object of variables. Objects nested in it become sections.
+type jsonImporter struct{}
+
+func (jsonImporter) Import(data []byte) ([]ImportedVariable, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if token != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object of variables")
+	}
+
+	var variables []ImportedVariable
+	if err := importJSONObject(decoder, "", &variables); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON object")
+	}
+	return variables, nil
+}
+
+// importJSONObject reads the members of an object whose opening brace was read.
+// Members of nested objects get the path to them as section.
+func importJSONObject(decoder *json.Decoder, section string, variables *[]ImportedVariable) error {
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		key := token.(string)
+
+		token, err = decoder.Token()
+		if err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		switch value := token.(type) {
+		case json.Delim:
+			if value != '{' {
+				return fmt.Errorf("%s is an array, only objects, strings, numbers and booleans can be imported", key)
+			}
+			if err := importJSONObject(decoder, joinSection(section, key), variables); err != nil {
+				return err
+			}
+		case string:
+			*variables = append(*variables, ImportedVariable{Section: section, Key: key, Value: value})
+		case json.Number:
+			*variables = append(*variables, ImportedVariable{Section: section, Key: key, Value: value.String()})
+		case bool:
+			*variables = append(*variables, ImportedVariable{Section: section, Key: key, Value: fmt.Sprint(value)})
+		case nil:
+			*variables = append(*variables, ImportedVariable{Section: section, Key: key})
+		}
+	}
+
+	// Closing brace
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nil
+}
+
+// yamlImporter reads a mapping of variables. Mappings nested in it become sections.
+type yamlImporter struct{}
+
+func (yamlImporter) Import(data []byte) ([]ImportedVariable, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a YAML mapping of variables")
+	}
+
+	var variables []ImportedVariable
+	if err := importYAMLMapping(root, "", &variables); err != nil {
+		return nil, err
+	}
+	return variables, nil
+}
+
+// importYAMLMapping reads the entries of a mapping. Entries of nested mappings
+// get the path to them as section.
+func importYAMLMapping(node *yaml.Node, section string, variables *[]ImportedVariable) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, resolveAlias(node.Content[i+1])
+		switch value.Kind {
+		case yaml.MappingNode:
+			if err := importYAMLMapping(value, joinSection(section, key), variables); err != nil {
+				return err
+			}
+		case yaml.ScalarNode:
+			*variables = append(*variables, ImportedVariable{Section: section, Key: key, Value: yamlScalar(value)})
+		default:
+			return fmt.Errorf("line %d: %s is a list, only mappings and scalars can be imported", value.Line, key)
+		}
+	}
+	return nil
+}
+
+// composeImporter reads the environment of each service of a Docker Compose
+// file, in a section named after the service
+type composeImporter struct{}
+
+func (composeImporter) Import(data []byte) ([]ImportedVariable, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	services := yamlValue(root, "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("no services found in the Compose file")
+	}
+
+	var variables []ImportedVariable
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		service := services.Content[i].Value
+		environment := yamlValue(resolveAlias(services.Content[i+1]), "environment")
+		if environment == nil {
+			continue
+		}
+
+		switch environment.Kind {
+		case yaml.MappingNode:
+			// environment: {KEY: value}
+			for j := 0; j+1 < len(environment.Content); j += 2 {
+				value := resolveAlias(environment.Content[j+1])
+				if value.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("line %d: %s of service %s must be a scalar", value.Line, environment.Content[j].Value, service)
+				}
+				variables = append(variables, ImportedVariable{Section: service, Key: environment.Content[j].Value, Value: yamlScalar(value)})
+			}
+		case yaml.SequenceNode:
+			// environment: ["KEY=value"], where a bare KEY is taken from the shell
+			for _, entry := range environment.Content {
+				key, value, ok := strings.Cut(entry.Value, "=")
+				if !ok {
+					return nil, fmt.Errorf("line %d: %s of service %s has no value, Compose takes it from the shell", entry.Line, key, service)
+				}
+				variables = append(variables, ImportedVariable{Section: service, Key: key, Value: value})
+			}
+		default:
+			return nil, fmt.Errorf("line %d: environment of service %s must be a mapping or a list", environment.Line, service)
+		}
+	}
+	return variables, nil
+}
+
+// parseYAML parses a YAML document, returning its root node or nil if it is empty
+func parseYAML(data []byte) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	return resolveAlias(document.Content[0]), nil
+}
+
+// yamlValue returns the value of key in a mapping, or nil
+func yamlValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolveAlias(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// resolveAlias follows *alias nodes to the node they refer to
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// yamlScalar returns the text of a scalar, with null as an empty value
+func yamlScalar(node *yaml.Node) string {
+	if node.Tag == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// joinSection appends a nested key to a section path, like database.primary
+func joinSection(section, key string) string {
+	if section == "" {
+		return key
+	}
+	return section + "." + key
+}
+
+// shellImporter reads `export KEY=value` assignments with POSIX quoting, like
+// the snippets written by `export --format shell`. Comment lines start sections,
+// as in .env files. Expansions like $VAR can't be resolved and are errors, and
+// a quoted ${ is kept as $${ like in .env files until it is stored.
+type shellImporter struct{}
+
+func (shellImporter) Import(data []byte) ([]ImportedVariable, error) {
+	s := &shellScanner{text: string(data), line: 1}
+	var variables []ImportedVariable
+	var errs []LineError
+	section := ""
+
+	for s.pos < len(s.text) {
+		switch c := s.text[s.pos]; {
+		case c == '\n':
+			s.line++
+			s.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == ';':
+			s.pos++
+		case c == '#':
+			comment := s.restOfLine()
+			if strings.HasPrefix(comment, "#!") {
+				continue // shebang
+			}
+			if name := strings.TrimSpace(strings.TrimPrefix(comment, "#")); name != "" {
+				section = name
+			}
+		default:
+			line := s.line
+			key, value, err := s.assignment()
+			if err != nil {
+				errs = append(errs, LineError{Line: line, Message: err.Error()})
+				s.restOfLine()
+				continue
+			}
+			variables = append(variables, ImportedVariable{Section: section, Key: key, Value: value})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &ParseError{Errors: errs}
+	}
+	return variables, nil
+}
+
+// shellScanner walks shell text one assignment at a time
+type shellScanner struct {
+	text string
+	pos  int
+	line int
+}
+
+// restOfLine consumes and returns the text up to the end of the current line
+func (s *shellScanner) restOfLine() string {
+	start := s.pos
+	for s.pos < len(s.text) && s.text[s.pos] != '\n' {
+		s.pos++
+	}
+	return s.text[start:s.pos]
+}
+
+// name consumes a shell variable name, or the export keyword
+func (s *shellScanner) name() string {
+	start := s.pos
+	for s.pos < len(s.text) {
+		c := s.text[s.pos]
+		if !(c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9' && s.pos > start)) {
+			break
+		}
+		s.pos++
+	}
+	return s.text[start:s.pos]
+}
+
+// assignment consumes `[export] KEY=word` and the comment after it
+func (s *shellScanner) assignment() (string, string, error) {
+	key := s.name()
+	if key == "export" && s.pos < len(s.text) && (s.text[s.pos] == ' ' || s.text[s.pos] == '\t') {
+		for s.pos < len(s.text) && (s.text[s.pos] == ' ' || s.text[s.pos] == '\t') {
+			s.pos++
+		}
+		key = s.name()
+	}
+	if key == "" {
+		return "", "", fmt.Errorf("expected an assignment, got %q", strings.TrimSpace(s.restOfLine()))
+	}
+	if s.pos >= len(s.text) || s.text[s.pos] != '=' {
+		return "", "", fmt.Errorf("expected '=' right after %q", key)
+	}
+	s.pos++
+
+	value, err := s.word(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Only blanks, a comment or another statement may follow
+	for s.pos < len(s.text) {
+		switch s.text[s.pos] {
+		case ' ', '\t', '\r':
+			s.pos++
+			continue
+		case '#':
+			s.restOfLine()
+		case '\n', ';':
+		default:
+			return "", "", fmt.Errorf("unexpected %q after the value of %s", s.text[s.pos], key)
+		}
+		break
+	}
+	return key, value, nil
+}
+
+// word consumes an unquoted, 'single-quoted' or "double-quoted" value, or
+// several of them written back to back
+func (s *shellScanner) word(key string) (string, error) {
+	var b strings.Builder
+	for s.pos < len(s.text) {
+		c := s.text[s.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';':
+			return b.String(), nil
+		case c == '\'':
+			end := strings.IndexByte(s.text[s.pos+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated single quote in the value of %s", key)
+			}
+			quoted := s.text[s.pos+1 : s.pos+1+end]
+			b.WriteString(strings.ReplaceAll(quoted, "${", "$${"))
+			s.line += strings.Count(quoted, "\n")
+			s.pos += end + 2
+		case c == '"':
+			if err := s.doubleQuoted(key, &b); err != nil {
+				return "", err
+			}
+		case c == '\\':
+			if s.pos+1 >= len(s.text) {
+				return "", fmt.Errorf("trailing backslash in the value of %s", key)
+			}
+			if s.text[s.pos+1] == '\n' {
+				s.line++ // line continuation
+			} else if s.text[s.pos+1] == '$' {
+				b.WriteString(literalDollar(s.text, s.pos+1))
+			} else {
+				b.WriteByte(s.text[s.pos+1])
+			}
+			s.pos += 2
+		case c == '$' || c == '`':
+			return "", fmt.Errorf("the value of %s uses %q expansion, which can't be imported", key, c)
+		case strings.IndexByte("|&<>()", c) >= 0:
+			return "", fmt.Errorf("unsupported shell syntax %q in the value of %s", c, key)
+		default:
+			b.WriteByte(c)
+			s.pos++
+		}
+	}
+	return b.String(), nil
+}
+
+// doubleQuoted consumes a double-quoted string, where a backslash only escapes
+// $ ` " \ and line breaks
+func (s *shellScanner) doubleQuoted(key string, b *strings.Builder) error {
+	for s.pos++; s.pos < len(s.text); s.pos++ {
+		c := s.text[s.pos]
+		switch c {
+		case '"':
+			s.pos++
+			return nil
+		case '$', '`':
+			return fmt.Errorf("the value of %s uses %q expansion, which can't be imported", key, c)
+		case '\\':
+			if s.pos+1 < len(s.text) && strings.IndexByte("$`\"\\\n", s.text[s.pos+1]) >= 0 {
+				s.pos++
+				if s.text[s.pos] == '\n' {
+					s.line++ // line continuation
+					continue
+				}
+				c = s.text[s.pos]
+				if c == '$' {
+					b.WriteString(literalDollar(s.text, s.pos))
+					continue
+				}
+			}
+		case '\n':
+			s.line++
+		}
+		b.WriteByte(c)
+	}
+	return fmt.Errorf("unterminated double quote in the value of %s", key)
+}
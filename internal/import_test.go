@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImporters(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		want   []ImportedVariable
+	}{
+		{
+			format: "json",
+			input:  `{"API_KEY": "secret", "PORT": 8080, "DEBUG": true, "EMPTY": null, "database": {"HOST": "db", "primary": {"USER": "app"}}}`,
+			want: []ImportedVariable{
+				{Key: "API_KEY", Value: "secret"},
+				{Key: "PORT", Value: "8080"},
+				{Key: "DEBUG", Value: "true"},
+				{Key: "EMPTY"},
+				{Section: "database", Key: "HOST", Value: "db"},
+				{Section: "database.primary", Key: "USER", Value: "app"},
+			},
+		},
+		{
+			format: "yaml",
+			input: `API_KEY: secret
+PORT: 8080
+EMPTY:
+database:
+  HOST: db
+  PASSWORD: "it's # not a comment"
+`,
+			want: []ImportedVariable{
+				{Key: "API_KEY", Value: "secret"},
+				{Key: "PORT", Value: "8080"},
+				{Key: "EMPTY"},
+				{Section: "database", Key: "HOST", Value: "db"},
+				{Section: "database", Key: "PASSWORD", Value: "it's # not a comment"},
+			},
+		},
+		{
+			format: "compose",
+			input: `services:
+  api:
+    image: api
+    environment:
+      API_KEY: secret
+      PORT: 8080
+  worker:
+    environment:
+      - QUEUE=jobs
+      - EMPTY=
+  db:
+    image: postgres
+`,
+			want: []ImportedVariable{
+				{Section: "api", Key: "API_KEY", Value: "secret"},
+				{Section: "api", Key: "PORT", Value: "8080"},
+				{Section: "worker", Key: "QUEUE", Value: "jobs"},
+				{Section: "worker", Key: "EMPTY"},
+			},
+		},
+		{
+			format: "shell",
+			input: `#!/bin/sh
+export API_KEY='it'\''s'  # inline comment
+PORT=8080; DEBUG="say \"hi\" \$5"
+
+# Database
+export CERT='line1
+line2'
+export PATH_PART=a\ b"c"'d'
+`,
+			want: []ImportedVariable{
+				{Key: "API_KEY", Value: "it's"},
+				{Key: "PORT", Value: "8080"},
+				{Key: "DEBUG", Value: `say "hi" $5`},
+				{Section: "Database", Key: "CERT", Value: "line1\nline2"},
+				{Section: "Database", Key: "PATH_PART", Value: "a bcd"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := importers[tt.format].Import([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unexpected variables:\n%+v\nexpected:\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportersRejectUnsupportedValues(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		want   string
+	}{
+		{"json", `["API_KEY"]`, "expected a JSON object"},
+		{"json", `{"HOSTS": ["a", "b"]}`, "HOSTS is an array"},
+		{"yaml", "HOSTS:\n  - a\n  - b\n", "HOSTS is a list"},
+		{"compose", "services:\n  api:\n    environment:\n      - API_KEY\n", "API_KEY of service api has no value"},
+		{"shell", "export HOME_DIR=$HOME\nPORT=8080\nNAME=\"$(whoami)\"\n", "2 invalid lines"},
+		{"shell", "export KEY='open\n", "unterminated single quote"},
+	}
+
+	for _, tt := range tests {
+		_, err := importers[tt.format].Import([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %q: expected error containing %q, got %v", tt.format, tt.input, tt.want, err)
+		}
+	}
+}
+
+func TestFileFormat(t *testing.T) {
+	tests := map[string]string{
+		".env":                    "dotenv",
+		".env.production":         "dotenv",
+		"secrets.json":            "json",
+		"values.yaml":             "yaml",
+		"config/app.yml":          "yaml",
+		"docker-compose.yml":      "compose",
+		"docker-compose.dev.yaml": "compose",
+		"compose.yaml":            "compose",
+		"env.sh":                  "shell",
+	}
+	for path, want := range tests {
+		if got := fileFormat(path, ""); got != want {
+			t.Errorf("fileFormat(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if got := fileFormat("secrets.json", "yaml"); got != "yaml" {
+		t.Errorf("Expected --format to win over the file name, got %q", got)
+	}
+}
+
+func TestShellExportRoundTrip(t *testing.T) {
+	data, err := formatters["shell"].Format(exportItem)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	got, err := importers["shell"].Import(data)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	fields := envFields(exportItem)
+	if len(got) != len(fields) {
+		t.Fatalf("Expected %d variables, got %d", len(fields), len(got))
+	}
+	for i, field := range fields {
+		if got[i].Key != field.Label || got[i].Value != field.Value {
+			t.Errorf("Expected %s=%q, got %s=%q", field.Label, field.Value, got[i].Key, got[i].Value)
+		}
+	}
+}
+
+func TestPushFromJSON(t *testing.T) {
+	app, backend := newTestApp(t, "Environments")
+	jsonFile := filepath.Join(t.TempDir(), "secrets.json")
+	if err := os.WriteFile(jsonFile, []byte(`{"API_KEY": "secret123", "redis": {"REDIS_HOST": "localhost"}}`), 0644); err != nil {
+		t.Fatalf("Failed to write JSON file: %v", err)
+	}
+
+	if err := app.Push(jsonFile, "Environments", "myapp", false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	item, err := backend.GetItemByName("Environments", "myapp")
+	if err != nil {
+		t.Fatalf("Item was not created: %v", err)
+	}
+	sections := make(map[string]string)
+	for _, field := range item.Fields {
+		if label, ok := field.Section["label"].(string); ok {
+			sections[field.Label] = label
+		}
+	}
+	if !reflect.DeepEqual(fieldValues(item), map[string]string{"API_KEY": "secret123", "REDIS_HOST": "localhost"}) {
+		t.Errorf("Unexpected fields: %v", fieldValues(item))
+	}
+	if sections["REDIS_HOST"] != "redis" {
+		t.Errorf("Expected REDIS_HOST in section redis, got %q", sections["REDIS_HOST"])
+	}
+	for _, field := range item.Fields {
+		if field.Label == "API_KEY" && field.Type != "CONCEALED" {
+			t.Errorf("Expected API_KEY to be concealed, got %s", field.Type)
+		}
+	}
+
+	// Pull refuses to write a .env file over the JSON file
+	err = app.Pull(jsonFile, "Environments", "myapp", false)
+	if err == nil || !strings.Contains(err.Error(), "only writes .env files") {
+		t.Errorf("Expected pull to refuse a JSON file, got %v", err)
+	}
+	if content, _ := os.ReadFile(jsonFile); !strings.HasPrefix(string(content), "{") {
+		t.Errorf("JSON file was overwritten:\n%s", content)
+	}
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// templateSection is the result of {{ section "Name" }}. It prints as KEY=value
+// lines and can be ranged over for fields with .Label and .Value.
+type templateSection []onepassword.OnePasswordField
+
+func (s templateSection) String() string {
+	lines := make([]string, len(s))
+	for i, field := range s {
+		lines[i] = field.Label + "=" + quoteEnvValue(field.Value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Inject renders a template with the fields of a 1Password item and writes it to
+// outPath, or stdout when outPath is empty. Placeholders are {{ env "KEY" }} for
+// one variable and {{ section "Name" }} for the variables of a section, with
+// their references expanded. Anything that doesn't resolve is an error and
+// nothing is written.
+func (a *App) Inject(templatePath, outPath, vault, item string) error {
+	text, err := os.ReadFile(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read template: %w", err)
+	}
+
+	t, opItem, err := a.fetchItem(vault, item)
+	if err != nil {
+		return err
+	}
+
+	// Templates get the values references point to, like processes do
+	opItem, err = a.expandItem(opItem)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderTemplate(filepath.Base(templatePath), string(text), opItem)
+	if err != nil {
+		return err
+	}
+
+	if outPath == "" {
+		_, err = os.Stdout.Write(rendered)
+		return err
+	}
+
+	if err := os.WriteFile(outPath, rendered, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outPath, err)
+	}
+	ShowSuccess("Rendered", templatePath, outPath+" from "+t.Vault+"/"+t.Item)
+	return nil
+}
+
+// renderTemplate executes a template against the variables of an item
+func renderTemplate(name, text string, item *onepassword.OnePasswordItem) ([]byte, error) {
+	fields := envFields(item)
+
+	funcs := template.FuncMap{
+		"env": func(key string) (string, error) {
+			for _, field := range fields {
+				if field.Label == key {
+					return field.Value, nil
+				}
+			}
+			return "", fmt.Errorf("variable %s not found in %s", key, item.Title)
+		},
+		"section": func(name string) (templateSection, error) {
+			var section templateSection
+			for _, field := range fields {
+				if fieldSection(field) == name {
+					section = append(section, field)
+				}
+			}
+			if len(section) == 0 {
+				return nil, fmt.Errorf("section %q not found in %s", name, item.Title)
+			}
+			return section, nil
+		},
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, nil); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,371 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// SetExpand makes pull write values with their ${VAR} and op:// references
+// expanded. Pushing such a file keeps the references in 1Password.
+func (a *App) SetExpand(expand bool) {
+	a.expand = expand
+}
+
+// expandValue replaces the references of a value with what lookup returns for
+// them. ${VAR:-default} uses default when VAR is unset or empty, ${VAR-default}
+// only when it is unset, and $${ is a literal ${. A ${VAR} that is unset is
+// kept as written: items pushed before references were expanded, or edited in
+// 1Password, may hold it as literal text.
+func expandValue(value string, lookup func(name string) (string, bool, error)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if strings.HasPrefix(value[i:], "$${") {
+			b.WriteString("${")
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(value[i:], "${") {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		end := closingBrace(value, i+2)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference %s", value[i:])
+		}
+		expanded, err := expandReference(value[i+2:end], lookup)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(expanded)
+		i = end
+	}
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the } closing a reference whose body starts
+// at value[start], skipping the references nested in its default
+func closingBrace(value string, start int) int {
+	depth := 0
+	for i := start; i < len(value); i++ {
+		switch {
+		case strings.HasPrefix(value[i:], "${"):
+			depth++
+			i++
+		case value[i] == '}' && depth == 0:
+			return i
+		case value[i] == '}':
+			depth--
+		}
+	}
+	return -1
+}
+
+// expandReference expands the body of a ${...} reference
+func expandReference(body string, lookup func(name string) (string, bool, error)) (string, error) {
+	name := body
+	operator, fallback := "", ""
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '_' || c == '.' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9' && i > 0) {
+			continue
+		}
+		name = body[:i]
+		switch {
+		case strings.HasPrefix(body[i:], ":-"):
+			operator, fallback = ":-", body[i+2:]
+		case body[i] == '-':
+			operator, fallback = "-", body[i+1:]
+		default:
+			return "", fmt.Errorf("invalid reference ${%s}, expected ${VAR} or ${VAR:-default}", body)
+		}
+		break
+	}
+	if name == "" {
+		return "", fmt.Errorf("invalid reference ${%s}, expected ${VAR} or ${VAR:-default}", body)
+	}
+
+	value, ok, err := lookup(name)
+	if err != nil {
+		return "", err
+	}
+	if (operator == ":-" && value == "") || (operator == "-" && !ok) {
+		return expandValue(fallback, lookup)
+	}
+	if !ok && operator == "" {
+		return "${" + body + "}", nil
+	}
+	return value, nil
+}
+
+// literalValue escapes the ${ of an expanded value, so that it is kept as
+// written instead of being read as a reference again
+func literalValue(value string) string {
+	return strings.ReplaceAll(value, "${", "$${")
+}
+
+// isReference reports whether a value refers to other values, so that it can
+// differ from what it expands to
+func isReference(value string) bool {
+	return strings.HasPrefix(value, "op://") || strings.Contains(value, "${")
+}
+
+// Values are stored in 1Password as written, so that op read and the 1Password
+// app show them as they are. The variables holding ${VAR} references are listed
+// in a hidden field instead, with where the literal ${ of their values are. The
+// values of other variables are taken literally.
+const referencesLabel = "references"
+
+// isReferencesField reports whether a field lists the variables holding references
+func isReferencesField(field onepassword.OnePasswordField) bool {
+	return field.Label == referencesLabel && fieldSection(field) == layoutSection
+}
+
+// storedValue returns a value as stored in 1Password, with $${ written as ${,
+// the offsets of those literal ${ in it, and whether it holds references
+func storedValue(value string) (string, []int, bool) {
+	var b strings.Builder
+	literals := []int{}
+	references := false
+	for i := 0; i < len(value); i++ {
+		switch {
+		case strings.HasPrefix(value[i:], "$${"):
+			literals = append(literals, b.Len())
+			b.WriteString("${")
+			i += 2
+		case strings.HasPrefix(value[i:], "${"):
+			references = true
+			b.WriteString("${")
+			i++
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String(), literals, references
+}
+
+// loadedValue turns a value stored in 1Password back into the form .env files
+// hold it, escaping its literal ${ as $${. Every ${ of a value without
+// references is literal.
+func loadedValue(stored string, literals []int, references bool) string {
+	if !references {
+		return literalValue(stored)
+	}
+	literal := make(map[int]bool)
+	for _, i := range literals {
+		literal[i] = true
+	}
+	var b strings.Builder
+	for i := 0; i < len(stored); i++ {
+		if literal[i] && strings.HasPrefix(stored[i:], "${") {
+			b.WriteByte('$')
+		}
+		b.WriteByte(stored[i])
+	}
+	return b.String()
+}
+
+// itemReferences maps the variables of an item holding references to the
+// offsets of their literal ${, as its hidden field lists them
+func itemReferences(item *onepassword.OnePasswordItem) map[string][]int {
+	references := make(map[string][]int)
+	for _, field := range item.Fields {
+		if isReferencesField(field) {
+			json.Unmarshal([]byte(field.Value), &references) // Values are literal if it can't be read
+		}
+	}
+	return references
+}
+
+// referencesField lists the variables of an item holding references in the
+// hidden field stored along with them, if any does
+func referencesField(item *onepassword.OnePasswordItem) (onepassword.OnePasswordField, bool) {
+	references := make(map[string][]int)
+	for _, field := range envFields(item) {
+		if _, literals, ok := storedValue(field.Value); ok {
+			references[field.Label] = literals
+		}
+	}
+	if len(references) == 0 {
+		return onepassword.OnePasswordField{}, false
+	}
+	data, _ := json.Marshal(references)
+	return onepassword.OnePasswordField{
+		Type:    "STRING",
+		Label:   referencesLabel,
+		Value:   string(data),
+		Section: map[string]interface{}{"label": layoutSection},
+	}, true
+}
+
+// referencesChanges lists the changes needed to turn the references field of
+// item "from" into that of item "to"
+func referencesChanges(from, to *onepassword.OnePasswordItem) []FieldChange {
+	var old *onepassword.OnePasswordField
+	for i, field := range from.Fields {
+		if isReferencesField(field) {
+			old = &from.Fields[i]
+		}
+	}
+	field, ok := referencesField(to)
+	switch {
+	case ok && old == nil:
+		return []FieldChange{{Kind: FieldAdded, Label: field.Label, New: field}}
+	case ok && old.Value != field.Value:
+		return []FieldChange{{Kind: FieldChanged, Label: field.Label, Old: *old, New: field}}
+	case !ok && old != nil:
+		return []FieldChange{{Kind: FieldRemoved, Label: old.Label, Old: *old}}
+	}
+	return nil
+}
+
+// loadValues turns the values of an item fetched from 1Password into the form
+// .env files hold them
+func loadValues(item *onepassword.OnePasswordItem) {
+	references := itemReferences(item)
+	for i, field := range item.Fields {
+		if isEnvField(field) {
+			literals, ok := references[field.Label]
+			item.Fields[i].Value = loadedValue(field.Value, literals, ok)
+		}
+	}
+}
+
+// storedFields returns the variables among fields with their values as
+// stored in 1Password
+func storedFields(fields []onepassword.OnePasswordField) []onepassword.OnePasswordField {
+	stored := make([]onepassword.OnePasswordField, len(fields))
+	for i, field := range fields {
+		stored[i] = field
+		if isEnvField(field) {
+			stored[i].Value, _, _ = storedValue(field.Value)
+		}
+	}
+	return stored
+}
+
+// expander returns a function expanding the variables of an item by name.
+// References point to other variables of the item first, then to the process
+// environment. Values that are op:// secret references are read from 1Password.
+// Names that are neither are added to unset, unless it is nil.
+func (a *App) expander(item *onepassword.OnePasswordItem, unset map[string]bool) func(name string) (string, bool, error) {
+	raw := make(map[string]string)
+	for _, field := range envFields(item) {
+		raw[field.Label] = field.Value
+	}
+	expanded := make(map[string]string)
+	expanding := make(map[string]bool)
+
+	var lookup func(name string) (string, bool, error)
+	lookup = func(name string) (string, bool, error) {
+		if value, ok := expanded[name]; ok {
+			return value, true, nil
+		}
+		value, ok := raw[name]
+		if !ok {
+			value, ok := os.LookupEnv(name)
+			if !ok && unset != nil {
+				unset[name] = true
+			}
+			return value, ok, nil
+		}
+		if expanding[name] {
+			return "", false, fmt.Errorf("%s refers back to itself", name)
+		}
+		expanding[name] = true
+		defer delete(expanding, name)
+
+		var err error
+		if strings.HasPrefix(value, "op://") {
+			value, err = a.backend.ReadReference(value)
+		} else {
+			value, err = expandValue(value, lookup)
+		}
+		if err != nil {
+			return "", false, err
+		}
+		expanded[name] = value
+		return value, true, nil
+	}
+	return lookup
+}
+
+// expandItem returns a copy of an item with the references of its values
+// expanded, warning about the references to unset variables it kept as written
+func (a *App) expandItem(item *onepassword.OnePasswordItem) (*onepassword.OnePasswordItem, error) {
+	unset := make(map[string]bool)
+	lookup := a.expander(item, unset)
+	result := *item
+	result.Fields = append([]onepassword.OnePasswordField(nil), item.Fields...)
+
+	for i, field := range result.Fields {
+		if !isEnvField(field) || !isReference(field.Value) {
+			continue
+		}
+		value, _, err := lookup(field.Label)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand %s: %w", field.Label, err)
+		}
+		result.Fields[i].Value = value
+	}
+
+	var kept []string
+	for name := range unset {
+		for _, field := range envFields(&result) {
+			if strings.Contains(field.Value, "${"+name+"}") {
+				kept = append(kept, name)
+				break
+			}
+		}
+	}
+	if len(kept) > 0 {
+		sort.Strings(kept)
+		fmt.Fprintf(os.Stderr, "%s %s not set, references to them were kept as written.\n", Yellow("⚠"), strings.Join(kept, ", "))
+	}
+	return &result, nil
+}
+
+// restoreReferences puts the references of an item back in place of the values
+// they expand to, which a .env file holds after `pull --expand`, so that expanded
+// values are never pushed and don't count as local changes
+func (a *App) restoreReferences(local, remote *onepassword.OnePasswordItem) {
+	if remote == nil {
+		return
+	}
+	references := make(map[string]string)
+	for _, field := range envFields(remote) {
+		if isReference(field.Value) {
+			references[field.Label] = field.Value
+		}
+	}
+	if len(references) == 0 {
+		return
+	}
+
+	// Expand with the values the file holds, which is what it was pulled with
+	// even if the variables referred to changed in 1Password since
+	withReferences := *local
+	withReferences.Fields = append([]onepassword.OnePasswordField(nil), local.Fields...)
+	for i, field := range withReferences.Fields {
+		if reference, ok := references[field.Label]; ok && isEnvField(field) {
+			withReferences.Fields[i].Value = reference
+		}
+	}
+
+	lookup := a.expander(&withReferences, nil)
+	for i, field := range local.Fields {
+		reference, ok := references[field.Label]
+		if !ok || !isEnvField(field) || field.Value == reference {
+			continue
+		}
+		// References that no longer expand can't be what the file holds
+		if value, _, err := lookup(field.Label); err == nil && literalValue(value) == field.Value {
+			local.Fields[i].Value = reference
+		}
+	}
+}
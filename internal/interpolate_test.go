@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandValue(t *testing.T) {
+	variables := map[string]string{"USER": "app", "HOST": "db", "EMPTY": ""}
+	lookup := func(name string) (string, bool, error) {
+		value, ok := variables[name]
+		return value, ok, nil
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain $HOME", "plain $HOME"},
+		{"postgres://${USER}@${HOST}/app", "postgres://app@db/app"},
+		{"${MISSING:-fallback}", "fallback"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"${EMPTY-fallback}", ""},
+		{"${MISSING-fallback}", "fallback"},
+		{"${MISSING:-${HOST}:5432}", "db:5432"},
+		{"${MISSING:-}", ""},
+		{"$${USER} is literal", "${USER} is literal"},
+		{"cost ${MISSING}", "cost ${MISSING}"},
+	}
+	for _, tt := range tests {
+		got, err := expandValue(tt.value, lookup)
+		if err != nil {
+			t.Errorf("expandValue(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expandValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	for value, want := range map[string]string{
+		"${USER":     "unterminated reference",
+		"${USER:=x}": "invalid reference",
+		"${}":        "invalid reference",
+	} {
+		if _, err := expandValue(value, lookup); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expandValue(%q): expected error containing %q, got %v", value, want, err)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// The layout of a .env file is stored in a field of a hidden section of its
+// item, which isn't a variable
+const (
+	layoutSection = "op-dotenv"
+	layoutLabel   = "layout"
+)
+
+// envLayout is how a .env file was written, without its values: comment and
+// blank lines, the order of its variables and how each was quoted. Pull writes
+// a file with a layout back byte for byte while its variables stay the same.
+type envLayout struct {
+	BOM            bool         `json:"bom,omitempty"`
+	CRLF           bool         `json:"crlf,omitempty"`
+	NoFinalNewline bool         `json:"noFinalNewline,omitempty"`
+	Lines          []layoutLine `json:"lines"`
+}
+
+// layoutLine is a variable when Key is set, the notes header when Notes is set,
+// and a blank or comment line written as is otherwise
+type layoutLine struct {
+	Text    string `json:"text,omitempty"`    // the line as written, or the lines of the notes header
+	Notes   bool   `json:"notes,omitempty"`   // Text is a notes header block
+	Heading string `json:"heading,omitempty"` // section a comment line starts
+	Key     string `json:"key,omitempty"`
+	Section string `json:"section,omitempty"` // section the variable is in
+	Above   string `json:"above,omitempty"`   // comment lines above the variable: its description and annotation
+	Prefix  string `json:"prefix,omitempty"`
+	Quote   string `json:"quote,omitempty"`
+	Escapes string `json:"escapes,omitempty"`
+	Suffix  string `json:"suffix,omitempty"`
+}
+
+// newLayout starts the layout of a .env file with the given content
+func newLayout(content string) *envLayout {
+	return &envLayout{
+		BOM:            strings.HasPrefix(content, "\ufeff"),
+		CRLF:           strings.Contains(content, "\r\n"),
+		NoFinalNewline: content != "" && !strings.HasSuffix(content, "\n"),
+	}
+}
+
+// field stores the layout in the hidden field of an item
+func (l *envLayout) field() onepassword.OnePasswordField {
+	data, _ := json.Marshal(l)
+	return onepassword.OnePasswordField{
+		Type:    "STRING",
+		Label:   layoutLabel,
+		Value:   string(data),
+		Section: map[string]interface{}{"label": layoutSection},
+	}
+}
+
+// isLayoutField reports whether a field holds the layout of a .env file
+func isLayoutField(field onepassword.OnePasswordField) bool {
+	return field.Label == layoutLabel && fieldSection(field) == layoutSection
+}
+
+// itemLayout returns the layout field of an item, if it has one
+func itemLayout(item *onepassword.OnePasswordItem) (onepassword.OnePasswordField, bool) {
+	if item != nil {
+		for _, field := range item.Fields {
+			if isLayoutField(field) {
+				return field, true
+			}
+		}
+	}
+	return onepassword.OnePasswordField{}, false
+}
+
+// parseLayout reads the layout of an item, or returns nil if it has none that
+// can be used
+func parseLayout(item *onepassword.OnePasswordItem) *envLayout {
+	field, ok := itemLayout(item)
+	if !ok {
+		return nil
+	}
+	var layout envLayout
+	if err := json.Unmarshal([]byte(field.Value), &layout); err != nil {
+		return nil
+	}
+	return &layout
+}
+
+// headerNotes returns the notes a header block holds, as parseEnvFile reads them
+func headerNotes(block string) []string {
+	var notes []string
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || headerStartPattern.MatchString(line) {
+			continue
+		}
+		notes = append(notes, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+	}
+	return notes
+}
+
+// renderedLine is a line (or a block of lines) render writes
+type renderedLine struct {
+	text     string
+	heading  string // section the line starts
+	variable bool
+}
+
+// render writes an item following the layout. Variables keep their place and
+// quoting, and the comments and blank lines around them are kept. Variables the
+// layout doesn't know (or that moved to another section) go after the last
+// variable of their section, or in a new section at the end. Section headings
+// whose variables were all removed are dropped. A variable set more than once,
+// in the item or the layout, is an error.
+func (l *envLayout) render(item *onepassword.OnePasswordItem, conflicts map[string]MergeConflict, conceal *concealer, envLine func(onepassword.OnePasswordField) string) (string, error) {
+	descriptions := itemDescriptions(item)
+	fields := make(map[string]onepassword.OnePasswordField)
+	sectionUsed := make(map[string]bool)
+	for _, field := range envFields(item) {
+		if _, exists := fields[field.Label]; exists {
+			return "", fmt.Errorf("%s is set more than once", field.Label)
+		}
+		fields[field.Label] = field
+		sectionUsed[fieldSection(field)] = true
+	}
+	notes := itemNotes(item).Value
+
+	// Sections that had variables, and notes as the header blocks hold them
+	sectionHad := make(map[string]bool)
+	var layoutNotes []string
+	for _, line := range l.Lines {
+		if line.Key != "" {
+			sectionHad[line.Section] = true
+		}
+		if line.Notes {
+			layoutNotes = append(layoutNotes, headerNotes(line.Text)...)
+		}
+	}
+	notesKept := strings.Join(layoutNotes, "\n") == notes
+
+	var out []renderedLine
+	anchors := make(map[string]int) // last line of each section, new variables go after it
+	notesAnchor := -1
+	written := make(map[string]bool)
+	laidOut := make(map[string]bool) // variables the layout has a line for
+	notesWritten := false
+
+	// chunk formats a variable, or its conflict block, without the final line break
+	chunk := func(field onepassword.OnePasswordField, format func(onepassword.OnePasswordField) string) renderedLine {
+		if conflict, exists := conflicts[field.Label]; exists {
+			return renderedLine{text: strings.TrimSuffix(conflictBlock(conflict, envLine), "\n"), variable: true}
+		}
+		return renderedLine{text: strings.TrimSuffix(format(field), "\n"), variable: true}
+	}
+
+	for _, line := range l.Lines {
+		switch {
+		case line.Notes:
+			if notesWritten && !notesKept {
+				continue
+			}
+			notesWritten = true
+			switch {
+			case conflicts["notesPlain"].Label != "":
+				out = append(out, renderedLine{text: strings.TrimSuffix(conflictBlock(conflicts["notesPlain"], notesHeader), "\n")})
+			case notesKept:
+				out = append(out, renderedLine{text: line.Text})
+			case notes != "":
+				out = append(out, renderedLine{text: strings.TrimSuffix(notesHeader(onepassword.OnePasswordField{Value: notes}), "\n")})
+			default:
+				continue
+			}
+			notesAnchor = len(out) - 1
+
+		case line.Key != "":
+			field, exists := fields[line.Key]
+			if laidOut[line.Key] {
+				return "", fmt.Errorf("the layout of the file sets %s more than once", line.Key)
+			}
+			laidOut[line.Key] = true
+			if !exists || fieldSection(field) != line.Section {
+				continue
+			}
+			written[line.Key] = true
+			out = append(out, chunk(field, func(field onepassword.OnePasswordField) string {
+				return line.format(field, descriptions[field.Label], conceal)
+			}))
+			anchors[line.Section] = len(out) - 1
+
+		case line.Heading != "" && sectionHad[line.Heading] && !sectionUsed[line.Heading]:
+			// All variables of the section are gone, and so are blank lines before it
+			for len(out) > 0 && strings.TrimSpace(out[len(out)-1].text) == "" {
+				out = out[:len(out)-1]
+			}
+
+		default:
+			out = append(out, renderedLine{text: line.Text, heading: line.Heading})
+			if line.Heading != "" {
+				anchors[line.Heading] = len(out) - 1
+			}
+		}
+	}
+
+	// Notes the layout had no header for go first
+	var top []renderedLine
+	if !notesWritten && (notes != "" || conflicts["notesPlain"].Label != "") {
+		if conflict, exists := conflicts["notesPlain"]; exists {
+			top = append(top, renderedLine{text: strings.TrimSuffix(conflictBlock(conflict, notesHeader), "\n")})
+		} else {
+			top = append(top, renderedLine{text: strings.TrimSuffix(notesHeader(onepassword.OnePasswordField{Value: notes}), "\n")})
+		}
+	}
+
+	// Place the variables the layout doesn't know
+	after := make(map[int][]renderedLine)
+	var ungrouped []renderedLine
+	var newSections []string
+	appended := make(map[string][]renderedLine)
+	for _, field := range envFields(item) {
+		if written[field.Label] {
+			continue
+		}
+		written[field.Label] = true
+		section := fieldSection(field)
+		text := chunk(field, envLine)
+
+		if anchor, ok := anchors[section]; ok {
+			after[anchor] = append(after[anchor], text)
+		} else if section == "" {
+			ungrouped = append(ungrouped, text)
+		} else {
+			if appended[section] == nil {
+				newSections = append(newSections, section)
+			}
+			appended[section] = append(appended[section], text)
+		}
+	}
+
+	var result []renderedLine
+	result = append(result, top...)
+	if len(ungrouped) > 0 && notesAnchor < 0 {
+		result = append(result, ungrouped...)
+		if len(out) > 0 {
+			result = append(result, renderedLine{})
+		}
+	}
+	for i, line := range out {
+		result = append(result, line)
+		result = append(result, after[i]...)
+		if i == notesAnchor && len(ungrouped) > 0 {
+			result = append(result, ungrouped...)
+		}
+	}
+	for _, section := range newSections {
+		if len(result) > 0 && strings.TrimSpace(result[len(result)-1].text) != "" {
+			result = append(result, renderedLine{})
+		}
+		result = append(result, renderedLine{text: "# " + section, heading: section})
+		result = append(result, appended[section]...)
+	}
+
+	lines := make([]string, len(result))
+	for i, line := range result {
+		lines[i] = line.text
+	}
+	if at := describedAfterBlank(result); at >= 0 && !l.marked() {
+		lines = markSections(result, at)
+	}
+
+	content := strings.Join(lines, "\n")
+	if len(lines) > 0 && !l.NoFinalNewline {
+		content += "\n"
+	}
+	if l.CRLF {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	if l.BOM {
+		content = "\ufeff" + content
+	}
+	return content, nil
+}
+
+// marked reports whether the file starts its sections with ## lines
+func (l *envLayout) marked() bool {
+	for _, line := range l.Lines {
+		if line.Key == "" && !line.Notes && markedSectionPattern.MatchString(strings.TrimSpace(line.Text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// describedAfterBlank returns the first variable described by comment lines
+// that comes after a blank line (or at the top), where the first of them would
+// start a section in a file without ## lines, or -1 if there is none
+func describedAfterBlank(lines []renderedLine) int {
+	for i, line := range lines {
+		if !line.variable || (i > 0 && strings.TrimSpace(lines[i-1].text) != "") {
+			continue
+		}
+		first, _, _ := strings.Cut(line.text, "\n")
+		if first = strings.TrimSpace(first); strings.HasPrefix(first, "#") && annotatedType(first) == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// markSections starts the sections of rendered lines with ## lines, so that
+// comment lines after blank lines describe the variable below them instead. A
+// bare ## goes before the described variable at if there are no sections.
+func markSections(lines []renderedLine, at int) []string {
+	var marked []string
+	found := false
+	for _, line := range lines {
+		if line.heading != "" {
+			found = true
+			marked = append(marked, "## "+line.heading)
+		} else {
+			marked = append(marked, line.text)
+		}
+	}
+	if !found {
+		marked = append(marked[:at], append([]string{"##"}, marked[at:]...)...)
+	}
+	return marked
+}
+
+// format writes a variable the way the layout line has it, keeping its quoting
+// when the value allows. A changed description replaces the comment lines
+// above the variable, and an annotation that no longer matches the field type
+// is replaced.
+func (line layoutLine) format(field onepassword.OnePasswordField, description string, conceal *concealer) string {
+	var above []string
+	if line.Above != "" {
+		above = strings.Split(line.Above, "\n")
+	}
+	annotation := ""
+	for _, text := range above {
+		if annotatedType(strings.TrimSpace(text)) != "" {
+			annotation = text
+		}
+	}
+	keptAnnotation := annotation
+	suffix := line.Suffix
+	inline := strings.TrimSpace(suffix)
+
+	annotated := annotatedType(strings.TrimSpace(annotation))
+	if inlineType := annotatedType(inline); strings.HasPrefix(inline, "#") && inlineType != "" {
+		annotated = inlineType
+		if inlineType != field.Type {
+			suffix = ""
+		}
+	}
+	if annotation != "" && annotatedType(strings.TrimSpace(annotation)) != field.Type {
+		annotation = ""
+	}
+	if annotated != field.Type {
+		if text := conceal.annotation(field.Label, field.Value, field.Type); text != "" {
+			if strings.HasPrefix(strings.TrimSpace(suffix), "#") {
+				annotation = text
+			} else {
+				suffix = " " + text
+			}
+		}
+	}
+
+	// The lines above stay as written unless what they say changed
+	if described := descriptionLines(above); describedAs(described) != description || annotation != keptAnnotation {
+		if describedAs(described) != description {
+			described = nil
+			if description != "" {
+				described = strings.Split(strings.TrimSuffix(descriptionComment(description), "\n"), "\n")
+			}
+		}
+		above = described
+		if annotation != "" {
+			above = append(above, annotation)
+		}
+	}
+
+	value := quoteLike(field.Value, line.Quote, line.Escapes)
+	if line.Quote == "" && value != "" && strings.HasPrefix(suffix, "#") {
+		suffix = " " + suffix // keep the comment from joining the value
+	}
+
+	text := line.Prefix + value + suffix
+	if len(above) > 0 {
+		text = strings.Join(above, "\n") + "\n" + text
+	}
+	return text
+}
+
+// quoteLike quotes a value the way another value was, if that lets lexDotenv
+// read it back unchanged, and like quoteEnvValue otherwise
+func quoteLike(value, quote, escapes string) string {
+	switch quote {
+	case `"`:
+		return writeDoubleQuoted(value, escapes)
+	case "'":
+		if !strings.Contains(value, "'") && !strings.Contains(strings.ReplaceAll(value, "$${", ""), "${") {
+			return "'" + strings.ReplaceAll(value, "$${", "${") + "'"
+		}
+	case "":
+		if value == "" || (strings.TrimSpace(value) == value && !strings.ContainsAny(value, "\n\r") &&
+			!strings.ContainsAny(value[:1], `'"#`) && !strings.Contains(value, " #") && !strings.Contains(value, "\t#")) {
+			return value
+		}
+	}
+	return quoteEnvValue(value)
+}
+
+// writeDoubleQuoted double-quotes a value, using the optional escapes among
+// \n, \t, \$ and \' only if they are listed in escapes. Line breaks are then
+// written as they are. With \ listed, for values that had unknown escapes like
+// \x41 and no \\, a backslash that can't be read as an escape is written bare.
+func writeDoubleQuoted(value, escapes string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.HasPrefix(value[i:], "$${"):
+			b.WriteString(`\$`) // a literal ${
+			i++
+		case c == '\\' && strings.Contains(escapes, `\`) && i+1 < len(value) && !strings.ContainsRune("nrt$'\"\\\n\r\t", rune(value[i+1])):
+			b.WriteByte(c)
+		case c == '\\' || c == '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\n' && strings.Contains(escapes, "n"):
+			b.WriteString(`\n`)
+		case c == '\t' && strings.Contains(escapes, "t"):
+			b.WriteString(`\t`)
+		case c == '\'' && strings.Contains(escapes, "'"):
+			b.WriteString(`\'`)
+		case c == '$' && strings.Contains(escapes, "$") && !strings.HasPrefix(value[i:], "${"):
+			b.WriteString(`\$`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
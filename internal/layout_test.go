@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// rewrite parses content and writes the item back after applying edit
+func rewrite(t *testing.T, content string, edit func(item *onepassword.OnePasswordItem)) string {
+	t.Helper()
+	envFile := writeEnvFile(t, content)
+	item, err := ParseEnvFileToItem(envFile, "test-item")
+	if err != nil {
+		t.Fatalf("ParseEnvFileToItem failed: %v", err)
+	}
+	if edit != nil {
+		edit(item)
+	}
+
+	outFile := filepath.Join(t.TempDir(), ".env")
+	if err := WriteItemToEnvFile(outFile, item); err != nil {
+		t.Fatalf("WriteItemToEnvFile failed: %v", err)
+	}
+	written, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	return string(written)
+}
+
+// setValue changes the value of a variable of an item
+func setValue(item *onepassword.OnePasswordItem, label, value string) {
+	for i := range item.Fields {
+		if item.Fields[i].Label == label && !isLayoutField(item.Fields[i]) {
+			item.Fields[i].Value = value
+		}
+	}
+}
+
+func TestLayoutRoundTrip(t *testing.T) {
+	tests := map[string]string{
+		"comments and blank lines": `# --------------------------------------------
+#   Notes with   odd spacing
+# --------------------------------------------
+
+
+# A comment that isn't a section
+export API_KEY = "secret"   # rotated monthly
+PLAIN=value
+SINGLE='literal $HOME'
+
+# Database
+# op:concealed
+DB_HOST=db.internal
+DB_PORT=5432 #op:text
+
+`,
+		"escapes and multiline values": `DOUBLE="tab\there \"quoted\" back\\slash"
+PEM="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+ESCAPED_NEWLINES="line\nline"
+LITERAL="\${A}"
+REFERENCE=${A}:${B:-x}
+EMPTY=
+QUOTED_EMPTY=''`,
+		"crlf and byte order mark": "\ufeffA=1\r\n\r\n# Section\r\nB='2'\r\n",
+		"unknown escapes": `KEY="\x41"
+PATH_LIKE="C:\Users\me\n"
+ESCAPED="C:\\Users"
+`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if written := rewrite(t, content, nil); written != content {
+				t.Errorf("Round trip changed the file:\n%q\nwant:\n%q", written, content)
+			}
+		})
+	}
+}
+
+func TestLayoutChanges(t *testing.T) {
+	content := `# Top comment
+A=1
+B='two'
+
+# Database
+DB_HOST=localhost # local only
+DB_PORT=5432
+
+# Cache
+REDIS_URL="redis://localhost"
+`
+
+	tests := []struct {
+		name string
+		edit func(item *onepassword.OnePasswordItem)
+		want string
+	}{
+		{
+			name: "changed values keep their quoting",
+			edit: func(item *onepassword.OnePasswordItem) {
+				setValue(item, "A", "10")
+				setValue(item, "DB_HOST", "db.internal")
+				setValue(item, "REDIS_URL", "redis://cache")
+			},
+			want: `# Top comment
+A=10
+B='two'
+
+# Database
+DB_HOST=db.internal # local only
+DB_PORT=5432
+
+# Cache
+REDIS_URL="redis://cache"
+`,
+		},
+		{
+			name: "values the quoting can't hold are requoted",
+			edit: func(item *onepassword.OnePasswordItem) {
+				setValue(item, "A", "has space #hash")
+				setValue(item, "B", "it's")
+			},
+			want: `# Top comment
+A='has space #hash'
+B="it's"
+
+# Database
+DB_HOST=localhost # local only
+DB_PORT=5432
+
+# Cache
+REDIS_URL="redis://localhost"
+`,
+		},
+		{
+			name: "removed variables and emptied sections are dropped",
+			edit: func(item *onepassword.OnePasswordItem) {
+				var kept []onepassword.OnePasswordField
+				for _, field := range item.Fields {
+					if field.Label != "B" && field.Label != "REDIS_URL" {
+						kept = append(kept, field)
+					}
+				}
+				item.Fields = kept
+			},
+			want: `# Top comment
+A=1
+
+# Database
+DB_HOST=localhost # local only
+DB_PORT=5432
+`,
+		},
+		{
+			name: "new variables go to the end of their section",
+			edit: func(item *onepassword.OnePasswordItem) {
+				item.Fields = append(item.Fields,
+					onepassword.OnePasswordField{Type: "STRING", Label: "C", Value: "3"},
+					onepassword.OnePasswordField{Type: "STRING", Label: "DB_NAME", Value: "app", Section: map[string]interface{}{"label": "Database"}},
+					onepassword.OnePasswordField{Type: "STRING", Label: "QUEUE", Value: "jobs", Section: map[string]interface{}{"label": "Queue"}},
+				)
+			},
+			want: `C='3'
+
+# Top comment
+A=1
+B='two'
+
+# Database
+DB_HOST=localhost # local only
+DB_PORT=5432
+DB_NAME='app'
+
+# Cache
+REDIS_URL="redis://localhost"
+
+# Queue
+QUEUE='jobs'
+`,
+		},
+		{
+			name: "variables moved to another section follow it",
+			edit: func(item *onepassword.OnePasswordItem) {
+				for i := range item.Fields {
+					if item.Fields[i].Label == "A" {
+						item.Fields[i].Section = map[string]interface{}{"label": "Cache"}
+					}
+				}
+			},
+			want: `# Top comment
+B='two'
+
+# Database
+DB_HOST=localhost # local only
+DB_PORT=5432
+
+# Cache
+REDIS_URL="redis://localhost"
+A='1'
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if written := rewrite(t, content, tt.edit); written != tt.want {
+				t.Errorf("Unexpected output:\n%s\nwant:\n%s", written, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutRejectsRepeatedKeys(t *testing.T) {
+	item, err := ParseEnvFileToItem(writeEnvFile(t, "KEY=first\nOTHER=1\n"), "test-item")
+	if err != nil {
+		t.Fatalf("ParseEnvFileToItem failed: %v", err)
+	}
+	item.Fields = append(item.Fields, onepassword.OnePasswordField{Type: "STRING", Label: "KEY", Value: "second"})
+
+	err = WriteItemToEnvFile(filepath.Join(t.TempDir(), ".env"), item)
+	if err == nil || !strings.Contains(err.Error(), "KEY is set more than once") {
+		t.Errorf("Expected an error about KEY, got %v", err)
+	}
+}
+
+func TestLayoutNotes(t *testing.T) {
+	content := `# ---
+# Old notes
+# ---
+
+A=1
+`
+	written := rewrite(t, content, func(item *onepassword.OnePasswordItem) {
+		for i := range item.Fields {
+			if item.Fields[i].ID == "notesPlain" {
+				item.Fields[i].Value = "New notes"
+			}
+		}
+	})
+	if !strings.Contains(written, "# New notes") || strings.Contains(written, "Old notes") {
+		t.Errorf("Changed notes should replace the header, got:\n%s", written)
+	}
+	if !strings.HasSuffix(written, "\n\nA=1\n") {
+		t.Errorf("Variables should keep their place after the notes, got:\n%s", written)
+	}
+}
+
+func FuzzLayoutRoundTrip(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"simple",
+		"it's",
+		`"double"`,
+		"multi\nline\nvalue",
+		"tab\there",
+		`back\slash\`,
+		" padded ",
+		"value # with hash",
+		"#start",
+		"$HOME and ${A}",
+		"$${literal}",
+	} {
+		f.Add(seed)
+	}
+
+	content := `PLAIN=x
+SINGLE='x'
+DOUBLE="x\n"
+COMMENTED=x # comment
+AFTER=sentinel
+`
+	f.Fuzz(func(t *testing.T, value string) {
+		written := rewrite(t, content, func(item *onepassword.OnePasswordItem) {
+			for _, label := range []string{"PLAIN", "SINGLE", "DOUBLE", "COMMENTED"} {
+				setValue(item, label, value)
+			}
+		})
+
+		parsed, err := ParseEnvFileToItem(writeEnvFile(t, written), "test-item")
+		if err != nil {
+			t.Fatalf("ParseEnvFileToItem failed for %q: %v\n%s", value, err, written)
+		}
+		got := fieldValues(parsed)
+		for _, label := range []string{"PLAIN", "SINGLE", "DOUBLE", "COMMENTED"} {
+			if got[label] != value {
+				t.Errorf("%s: round trip of %q gave %q in:\n%s", label, value, got[label], written)
+			}
+		}
+		if len(got) != 5 || got["AFTER"] != "sentinel" {
+			t.Errorf("Round trip of %q gave %q", value, got)
+		}
+	})
+}
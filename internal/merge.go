@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// MergeConflict is a variable changed differently on both sides since the last sync.
+// Local or Remote is nil when that side deleted the variable.
+type MergeConflict struct {
+	Label  string
+	Local  *onepassword.OnePasswordField
+	Remote *onepassword.OnePasswordField
+}
+
+// mergeItems does a three-way merge of a local and a remote item against the
+// base snapshot, variable by variable. A variable changed on one side only takes
+// that side's version. Without a base, variables that differ are conflicts.
+//
+// The merged item keeps the local field order, followed by variables only found
+// remotely, their descriptions and the local layout of the .env file.
+// Conflicting variables hold the local version (or the remote one if deleted
+// locally) until resolved with resolveConflict. Descriptions changed on both
+// sides aren't conflicts, the local one is kept.
+func mergeItems(base *SyncState, local, remote *onepassword.OnePasswordItem) (*onepassword.OnePasswordItem, []MergeConflict) {
+	if base == nil {
+		base = &SyncState{Fields: map[string]string{}}
+	}
+
+	localFields := mergeFields(local)
+	remoteFields := mergeFields(remote)
+
+	merged := &onepassword.OnePasswordItem{
+		ID:    remote.ID,
+		Title: local.Title,
+		Vault: remote.Vault,
+	}
+	var conflicts []MergeConflict
+
+	decide := func(label string) *onepassword.OnePasswordField {
+		l, r := localFields[label], remoteFields[label]
+		lh, rh, bh := base.hash(l), base.hash(r), base.Fields[label]
+
+		switch {
+		case lh == rh, rh == bh:
+			return l // Same on both sides, or only changed locally
+		case lh == bh:
+			return r // Only changed remotely
+		}
+
+		conflicts = append(conflicts, MergeConflict{Label: label, Local: l, Remote: r})
+		if l != nil {
+			return l
+		}
+		return r
+	}
+
+	var notes *onepassword.OnePasswordField
+	add := func(label string) {
+		field := decide(label)
+		if field == nil {
+			return
+		}
+		if label == "notesPlain" {
+			notes = field
+			return
+		}
+		merged.Fields = append(merged.Fields, *field)
+	}
+
+	for _, field := range envFields(local) {
+		add(field.Label)
+	}
+	for _, field := range envFields(remote) {
+		if localFields[field.Label] == nil {
+			add(field.Label)
+		}
+	}
+	add("notesPlain")
+
+	if notes != nil {
+		merged.Fields = append(merged.Fields, *notes)
+	}
+
+	// Files without a layout (in other formats) can't hold descriptions
+	localDescriptions := localFields
+	if _, ok := itemLayout(local); !ok {
+		localDescriptions = remoteFields
+	}
+	for _, field := range envFields(merged) {
+		key := descriptionKey(field.Label)
+		description := localDescriptions[key]
+		if r := remoteFields[key]; base.hash(description) == base.Fields[key] && base.hash(r) != base.Fields[key] {
+			description = r // Only changed remotely
+		}
+		if description != nil {
+			merged.Fields = append(merged.Fields, *description)
+		}
+	}
+
+	if layout, ok := itemLayout(local); ok {
+		merged.Fields = append(merged.Fields, layout)
+	} else if layout, ok := itemLayout(remote); ok {
+		merged.Fields = append(merged.Fields, layout)
+	}
+
+	return merged, conflicts
+}
+
+// resolveConflict settles a conflict in a merged item by picking one side
+func resolveConflict(merged *onepassword.OnePasswordItem, conflict MergeConflict, useLocal bool) {
+	chosen := conflict.Remote
+	if useLocal {
+		chosen = conflict.Local
+	}
+
+	for i, field := range merged.Fields {
+		if field.Label != conflict.Label || !isEnvField(field) {
+			continue
+		}
+		if chosen == nil {
+			merged.Fields = append(merged.Fields[:i], merged.Fields[i+1:]...)
+		} else {
+			merged.Fields[i] = *chosen
+		}
+		return
+	}
+}
+
+// conflictLabels lists the variables in conflict for messages
+func conflictLabels(conflicts []MergeConflict) string {
+	var labels []string
+	for _, conflict := range conflicts {
+		if conflict.Label == "notesPlain" {
+			labels = append(labels, "notes")
+		} else {
+			labels = append(labels, conflict.Label)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+// mergeFields indexes the variables of an item by label. Notes are included
+// under "notesPlain" when not empty, and descriptions under descriptionKey.
+func mergeFields(item *onepassword.OnePasswordItem) map[string]*onepassword.OnePasswordField {
+	fields := make(map[string]*onepassword.OnePasswordField)
+	for _, field := range envFields(item) {
+		field := field
+		fields[field.Label] = &field
+	}
+	if notes := itemNotes(item); notes.Value != "" {
+		fields["notesPlain"] = &notes
+	}
+	for label, description := range itemDescriptions(item) {
+		field := descriptionField(label, description)
+		fields[descriptionKey(label)] = &field
+	}
+	return fields
+}
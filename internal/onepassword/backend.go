@@ -0,0 +1,28 @@
+package onepassword
+
+// Backend is the storage layer that items are pushed to and pulled from.
+// CLI talks to a real 1Password account through the `op` binary, Fake keeps
+// everything in memory for tests.
+type Backend interface {
+	// CheckInstalled reports whether the backend can be used at all
+	CheckInstalled() error
+	// CheckSignedIn reports whether the backend is authenticated
+	CheckSignedIn() error
+	// SetAccount makes the following calls use one of the accounts signed in
+	// to, by its shorthand, sign-in address, email or ID. "" is the default one.
+	SetAccount(account string)
+
+	ListVaults() ([]VaultInfo, error)
+	CreateVault(vaultName string) error
+
+	ListItems(vault string) ([]ItemInfo, error)
+	GetItemByName(vault, itemName string) (*OnePasswordItem, error)
+	CreateItemFromFields(vault, itemName, notes string, fields []OnePasswordField) error
+	UpdateItemFields(vault, itemID, notes string, fields []OnePasswordField) error
+	DeleteItemFields(vault, itemID string, fields []OnePasswordField) error
+	DeleteItem(vault, itemID string) error
+
+	// ReadReference returns the value a secret reference like
+	// op://vault/item/[section/]field points to
+	ReadReference(reference string) (string, error)
+}
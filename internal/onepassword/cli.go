@@ -0,0 +1,39 @@
+package onepassword
+
+import (
+	"os/exec"
+)
+
+// CLI is the Backend implementation that shells out to the 1Password CLI
+type CLI struct {
+	account string // passed to every command with --account, if set
+}
+
+// NewCLI creates a backend that uses the `op` binary found on PATH
+func NewCLI() *CLI {
+	return &CLI{}
+}
+
+// CheckInstalled checks if the 1Password CLI is on PATH
+func (c *CLI) CheckInstalled() error {
+	_, err := exec.LookPath("op")
+	return err
+}
+
+// CheckSignedIn checks if the 1Password CLI has an active session
+func (c *CLI) CheckSignedIn() error {
+	return c.command("whoami").Run()
+}
+
+// SetAccount makes the following commands use the given account
+func (c *CLI) SetAccount(account string) {
+	c.account = account
+}
+
+// command builds an `op` invocation with the given arguments
+func (c *CLI) command(args ...string) *exec.Cmd {
+	if c.account != "" {
+		args = append(args, "--account", c.account)
+	}
+	return exec.Command("op", args...)
+}
@@ -0,0 +1,343 @@
+package onepassword
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake is an in-memory Backend that behaves like a signed-in 1Password
+// account. It is meant for tests and CI where no `op` session is available.
+type Fake struct {
+	// SignInErr, when set, is returned by CheckSignedIn
+	SignInErr error
+
+	// SignedOut lists the accounts CheckSignedIn fails for
+	SignedOut []string
+
+	mu            sync.Mutex
+	account       string // account set with SetAccount, "" for the default one
+	vaults        []VaultInfo
+	vaultAccounts map[string]string             // account of each vault, keyed by vault ID
+	items         map[string][]*OnePasswordItem // keyed by vault ID
+	nextID        int
+}
+
+// NewFake creates an empty fake backend with the given vaults
+func NewFake(vaultNames ...string) *Fake {
+	f := &Fake{items: make(map[string][]*OnePasswordItem), vaultAccounts: make(map[string]string)}
+	for _, name := range vaultNames {
+		f.CreateVault(name)
+	}
+	return f
+}
+
+// CheckInstalled always succeeds for the fake backend
+func (f *Fake) CheckInstalled() error {
+	return nil
+}
+
+// CheckSignedIn returns SignInErr, or an error if the account is signed out
+func (f *Fake) CheckSignedIn() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.SignInErr != nil {
+		return f.SignInErr
+	}
+	for _, account := range f.SignedOut {
+		if account == f.account {
+			return fmt.Errorf("account %s is not signed in", account)
+		}
+	}
+	return nil
+}
+
+// SetAccount switches to another account. Accounts don't need to be created,
+// each name holds the vaults created while it is set.
+func (f *Fake) SetAccount(account string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.account = account
+}
+
+// ListVaults returns the vaults of the account in creation order
+func (f *Fake) ListVaults() ([]VaultInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var vaults []VaultInfo
+	for _, v := range f.vaults {
+		if f.vaultAccounts[v.ID] == f.account {
+			vaults = append(vaults, v)
+		}
+	}
+	return vaults, nil
+}
+
+// CreateVault adds a new vault to the account. Duplicate names are allowed,
+// like in 1Password.
+func (f *Fake) CreateVault(vaultName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v := VaultInfo{ID: f.newID("vault"), Name: vaultName}
+	f.vaults = append(f.vaults, v)
+	f.vaultAccounts[v.ID] = f.account
+	return nil
+}
+
+// ListItems returns all items in a vault
+func (f *Fake) ListItems(vault string) ([]ItemInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.findVault(vault)
+	if !ok {
+		return nil, fmt.Errorf("failed to list items in vault '%s': vault not found", vault)
+	}
+
+	var items []ItemInfo
+	for _, item := range f.items[v.ID] {
+		items = append(items, ItemInfo{ID: item.ID, Title: item.Title})
+	}
+	return items, nil
+}
+
+// GetItemByName returns a copy of the item with the given title or ID
+func (f *Fake) GetItemByName(vault, itemName string) (*OnePasswordItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item := f.findItem(vault, itemName)
+	if item == nil {
+		return nil, fmt.Errorf("item '%s' not found in vault '%s'", itemName, vault)
+	}
+	return copyItem(item), nil
+}
+
+// CreateItemFromFields stores a new Secure Note item
+func (f *Fake) CreateItemFromFields(vault, itemName, notes string, fields []OnePasswordField) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.findVault(vault)
+	if !ok {
+		return fmt.Errorf("failed to create item: vault '%s' not found", vault)
+	}
+
+	item := &OnePasswordItem{
+		ID:        f.newID("item"),
+		Title:     itemName,
+		Version:   1,
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		Vault:     map[string]interface{}{"id": v.ID, "name": v.Name},
+		Fields: []OnePasswordField{
+			// Secure Notes always carry the built-in notes field
+			{ID: "notesPlain", Type: "STRING", Label: "notesPlain", Value: notes},
+		},
+	}
+	for _, field := range fields {
+		if field.ID == "notesPlain" {
+			continue
+		}
+		item.Fields = append(item.Fields, f.storedField(field))
+	}
+
+	f.items[v.ID] = append(f.items[v.ID], item)
+	return nil
+}
+
+// UpdateItemFields sets notes and upserts fields by section and label
+func (f *Fake) UpdateItemFields(vault, itemID, notes string, fields []OnePasswordField) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item := f.findItem(vault, itemID)
+	if item == nil {
+		return fmt.Errorf("failed to update item: item '%s' not found in vault '%s'", itemID, vault)
+	}
+
+	if notes != "" {
+		for i := range item.Fields {
+			if item.Fields[i].ID == "notesPlain" {
+				item.Fields[i].Value = notes
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if field.ID == "notesPlain" {
+			continue
+		}
+
+		updated := false
+		for i := range item.Fields {
+			existing := &item.Fields[i]
+			if existing.Label == field.Label && sectionLabel(existing.Section) == sectionLabel(field.Section) {
+				existing.Type = field.Type
+				existing.Value = field.Value
+				updated = true
+				break
+			}
+		}
+		if !updated {
+			item.Fields = append(item.Fields, f.storedField(field))
+		}
+	}
+
+	touch(item)
+	return nil
+}
+
+// DeleteItemFields removes fields by section and label
+func (f *Fake) DeleteItemFields(vault, itemID string, fields []OnePasswordField) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item := f.findItem(vault, itemID)
+	if item == nil {
+		return fmt.Errorf("failed to delete fields: item '%s' not found in vault '%s'", itemID, vault)
+	}
+
+	for _, field := range fields {
+		for i := range item.Fields {
+			existing := item.Fields[i]
+			if field.ID == "notesPlain" && existing.ID == "notesPlain" {
+				item.Fields[i].Value = ""
+				break
+			}
+			if existing.ID != "notesPlain" && existing.Label == field.Label && sectionLabel(existing.Section) == sectionLabel(field.Section) {
+				item.Fields = append(item.Fields[:i], item.Fields[i+1:]...)
+				break
+			}
+		}
+	}
+
+	touch(item)
+	return nil
+}
+
+// DeleteItem removes an item from a vault
+func (f *Fake) DeleteItem(vault, itemID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.findVault(vault)
+	if !ok {
+		return fmt.Errorf("failed to delete item: vault '%s' not found", vault)
+	}
+
+	items := f.items[v.ID]
+	for i, item := range items {
+		if item.ID == itemID {
+			f.items[v.ID] = append(items[:i], items[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to delete item: item '%s' not found in vault '%s'", itemID, vault)
+}
+
+// ReadReference resolves op://vault/item/[section/]field against the stored items.
+// Each part matches by ID or name, like `op read`.
+func (f *Fake) ReadReference(reference string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(reference, "op://"), "/")
+	if !strings.HasPrefix(reference, "op://") || len(parts) < 3 || len(parts) > 4 {
+		return "", fmt.Errorf("invalid secret reference %s", reference)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item := f.findItem(parts[0], parts[1])
+	if item == nil {
+		return "", fmt.Errorf("failed to read %s", reference)
+	}
+	section, name := "", parts[len(parts)-1]
+	if len(parts) == 4 {
+		section = parts[2]
+	}
+	for _, field := range item.Fields {
+		if field.ID != name && field.Label != name {
+			continue
+		}
+		if section != "" && section != sectionLabel(field.Section) && section != field.Section["id"] {
+			continue
+		}
+		return field.Value, nil
+	}
+	return "", fmt.Errorf("failed to read %s", reference)
+}
+
+// findVault resolves a vault of the account by ID, then by name
+func (f *Fake) findVault(vault string) (VaultInfo, bool) {
+	for _, v := range f.vaults {
+		if v.ID == vault && f.vaultAccounts[v.ID] == f.account {
+			return v, true
+		}
+	}
+	for _, v := range f.vaults {
+		if v.Name == vault && f.vaultAccounts[v.ID] == f.account {
+			return v, true
+		}
+	}
+	return VaultInfo{}, false
+}
+
+// findItem resolves an item by ID, then by title
+func (f *Fake) findItem(vault, itemName string) *OnePasswordItem {
+	v, ok := f.findVault(vault)
+	if !ok {
+		return nil
+	}
+	for _, item := range f.items[v.ID] {
+		if item.ID == itemName {
+			return item
+		}
+	}
+	for _, item := range f.items[v.ID] {
+		if item.Title == itemName {
+			return item
+		}
+	}
+	return nil
+}
+
+// storedField assigns the IDs 1Password would give a newly created field
+func (f *Fake) storedField(field OnePasswordField) OnePasswordField {
+	stored := field
+	stored.ID = f.newID("field")
+	if label := sectionLabel(field.Section); label != "" {
+		stored.Section = map[string]interface{}{"id": "section-" + label, "label": label}
+	}
+	return stored
+}
+
+// touch records an edit of an item, like 1Password does on every save
+func touch(item *OnePasswordItem) {
+	item.Version++
+	item.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+}
+
+func (f *Fake) newID(kind string) string {
+	f.nextID++
+	return fmt.Sprintf("%s%04d", kind, f.nextID)
+}
+
+// copyItem deep-copies an item so callers can't mutate the fake's state
+func copyItem(item *OnePasswordItem) *OnePasswordItem {
+	cp := *item
+	cp.Fields = make([]OnePasswordField, len(item.Fields))
+	for i, field := range item.Fields {
+		cp.Fields[i] = field
+		if field.Section != nil {
+			cp.Fields[i].Section = make(map[string]interface{}, len(field.Section))
+			for k, v := range field.Section {
+				cp.Fields[i].Section[k] = v
+			}
+		}
+	}
+	return &cp
+}
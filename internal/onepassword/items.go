@@ -1,14 +1,15 @@
 package onepassword
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os/exec"
 )
 
 // GetItemByName retrieves a 1Password item by name from a vault
-func GetItemByName(vault, itemName string) (*OnePasswordItem, error) {
-	cmd := exec.Command("op", "item", "get", itemName, "--vault", vault, "--format", "json")
+func (c *CLI) GetItemByName(vault, itemName string) (*OnePasswordItem, error) {
+	cmd := c.command("item", "get", itemName, "--vault", vault, "--format", "json")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("item '%s' not found in vault '%s'", itemName, vault)
@@ -24,41 +25,18 @@ func GetItemByName(vault, itemName string) (*OnePasswordItem, error) {
 }
 
 // ItemExists checks if an item exists in the specified vault
-func ItemExists(vault, itemName string) bool {
-	_, err := GetItemByName(vault, itemName)
+func ItemExists(backend Backend, vault, itemName string) bool {
+	_, err := backend.GetItemByName(vault, itemName)
 	return err == nil
 }
 
 // CreateItemFromFields creates a new 1Password item with the given fields
-func CreateItemFromFields(vault, itemName, notes string, fields []OnePasswordField) error {
-	args := []string{"item", "create", "--category", "Secure Note", "--title", itemName, "--vault", vault}
-
-	// Add notes if present
-	if notes != "" {
-		args = append(args, fmt.Sprintf("notesPlain=%s", notes))
-	}
-
-	// Add fields using assignment syntax (which works properly for sections and field types)
-	for _, field := range fields {
-		if field.ID == "notesPlain" {
-			continue // Already handled above
-		}
-
-		var fieldAssignment string
-		if field.Section != nil {
-			if sectionLabel, ok := field.Section["label"].(string); ok {
-				// Field with section: section.field[type]=value  
-				fieldAssignment = fmt.Sprintf("%s.%s[%s]=%s", sectionLabel, field.Label, field.Type, field.Value)
-			}
-		} else {
-			// Field without section: field[type]=value
-			fieldAssignment = fmt.Sprintf("%s[%s]=%s", field.Label, field.Type, field.Value)
-		}
-		
-		args = append(args, fieldAssignment)
+func (c *CLI) CreateItemFromFields(vault, itemName, notes string, fields []OnePasswordField) error {
+	cmd, err := c.createItemCommand(vault, itemName, notes, fields)
+	if err != nil {
+		return err
 	}
 
-	cmd := exec.Command("op", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to create item: %s", string(output))
@@ -67,36 +45,64 @@ func CreateItemFromFields(vault, itemName, notes string, fields []OnePasswordFie
 	return nil
 }
 
-// UpdateItemFields updates an existing 1Password item with new fields
-func UpdateItemFields(itemID, notes string, fields []OnePasswordField) error {
-	args := []string{"item", "edit", itemID}
+// createItemCommand builds `op item create` with the item template on stdin,
+// so that no field value appears in the process arguments
+func (c *CLI) createItemCommand(vault, itemName, notes string, fields []OnePasswordField) (*exec.Cmd, error) {
+	template, err := newItemTemplate(itemName, notes, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := c.command("item", "create", "--vault", vault)
+	cmd.Stdin = bytes.NewReader(template)
+	return cmd, nil
+}
 
+// UpdateItemFields updates an existing 1Password item with new fields.
+// Fields are matched by section and label; unmatched fields are added.
+func (c *CLI) UpdateItemFields(vault, itemID, notes string, fields []OnePasswordField) error {
 	// Update notes if present
+	var newNotes *string
 	if notes != "" {
-		args = append(args, fmt.Sprintf("notesPlain=%s", notes))
+		newNotes = &notes
 	}
 
-	// Update fields using same syntax as create (with field types)
+	return c.editItem(vault, itemID, newNotes, fields, nil)
+}
+
+// DeleteItemFields removes fields from an existing 1Password item.
+// Passing the notes field clears the item's notes.
+func (c *CLI) DeleteItemFields(vault, itemID string, fields []OnePasswordField) error {
+	var newNotes *string
+	var removals []OnePasswordField
+
 	for _, field := range fields {
 		if field.ID == "notesPlain" {
-			continue // Already handled above
+			empty := ""
+			newNotes = &empty
+			continue
 		}
+		removals = append(removals, field)
+	}
 
-		var fieldAssignment string
-		if field.Section != nil {
-			if sectionLabel, ok := field.Section["label"].(string); ok {
-				// Field with section: section.field[type]=value  
-				fieldAssignment = fmt.Sprintf("%s.%s[%s]=%s", sectionLabel, field.Label, field.Type, field.Value)
-			}
-		} else {
-			// Field without section: field[type]=value
-			fieldAssignment = fmt.Sprintf("%s[%s]=%s", field.Label, field.Type, field.Value)
-		}
-		
-		args = append(args, fieldAssignment)
+	return c.editItem(vault, itemID, newNotes, nil, removals)
+}
+
+// editItem fetches the current item, applies the changes and pipes the result
+// back to `op item edit` on stdin
+func (c *CLI) editItem(vault, itemID string, notes *string, upserts, removals []OnePasswordField) error {
+	current, err := c.command("item", "get", itemID, "--vault", vault, "--format", "json").Output()
+	if err != nil {
+		return fmt.Errorf("item '%s' not found in vault '%s'", itemID, vault)
 	}
 
-	cmd := exec.Command("op", args...)
+	template, err := editItemTemplate(current, notes, upserts, removals)
+	if err != nil {
+		return err
+	}
+
+	cmd := c.command("item", "edit", itemID, "--vault", vault)
+	cmd.Stdin = bytes.NewReader(template)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to update item: %s", string(output))
@@ -105,9 +111,28 @@ func UpdateItemFields(itemID, notes string, fields []OnePasswordField) error {
 	return nil
 }
 
+// DeleteItem removes an item from a vault
+func (c *CLI) DeleteItem(vault, itemID string) error {
+	cmd := c.command("item", "delete", itemID, "--vault", vault)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to delete item: %s", string(output))
+	}
+	return nil
+}
+
+// ReadReference resolves a secret reference with `op read`
+func (c *CLI) ReadReference(reference string) (string, error) {
+	output, err := c.command("read", "--no-newline", reference).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s", reference)
+	}
+	return string(output), nil
+}
+
 // ListItems returns all items in a vault
-func ListItems(vault string) ([]ItemInfo, error) {
-	cmd := exec.Command("op", "item", "list", "--vault", vault, "--format", "json")
+func (c *CLI) ListItems(vault string) ([]ItemInfo, error) {
+	cmd := c.command("item", "list", "--vault", vault, "--format", "json")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list items in vault '%s': %w", vault, err)
@@ -120,4 +145,4 @@ func ListItems(vault string) ([]ItemInfo, error) {
 	}
 
 	return items, nil
-}
\ No newline at end of file
+}
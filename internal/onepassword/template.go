@@ -0,0 +1,192 @@
+package onepassword
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// itemTemplate is the JSON shape `op item create` and `op item edit` read from stdin.
+// Sending items this way keeps secret values out of process arguments.
+type itemTemplate struct {
+	Title    string            `json:"title"`
+	Category string            `json:"category"`
+	Sections []templateSection `json:"sections,omitempty"`
+	Fields   []templateField   `json:"fields"`
+}
+
+type templateSection struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type templateField struct {
+	ID      string           `json:"id,omitempty"`
+	Type    string           `json:"type"`
+	Purpose string           `json:"purpose,omitempty"`
+	Label   string           `json:"label"`
+	Value   string           `json:"value"`
+	Section *templateSection `json:"section,omitempty"`
+}
+
+// newItemTemplate builds the template for a new Secure Note item
+func newItemTemplate(itemName, notes string, fields []OnePasswordField) ([]byte, error) {
+	tmpl := itemTemplate{
+		Title:    itemName,
+		Category: "SECURE_NOTE",
+		Fields: []templateField{
+			{ID: "notesPlain", Type: "STRING", Purpose: "NOTES", Label: "notesPlain", Value: notes},
+		},
+	}
+
+	sectionIDs := make(map[string]string)
+	for _, field := range fields {
+		if field.ID == "notesPlain" {
+			continue // Already handled above
+		}
+
+		tf := templateField{Type: field.Type, Label: field.Label, Value: field.Value}
+		if label := sectionLabel(field.Section); label != "" {
+			id, exists := sectionIDs[label]
+			if !exists {
+				id = newSectionID()
+				sectionIDs[label] = id
+				tmpl.Sections = append(tmpl.Sections, templateSection{ID: id, Label: label})
+			}
+			tf.Section = &templateSection{ID: id, Label: label}
+		}
+		tmpl.Fields = append(tmpl.Fields, tf)
+	}
+
+	return json.Marshal(tmpl)
+}
+
+// editItemTemplate applies changes to an item as returned by `op item get --format json`.
+// The item is edited as generic JSON so properties op-dotenv doesn't model (tags, urls...)
+// are sent back untouched. Fields are matched by section and label.
+func editItemTemplate(itemJSON []byte, notes *string, upserts, removals []OnePasswordField) ([]byte, error) {
+	var item map[string]interface{}
+	if err := json.Unmarshal(itemJSON, &item); err != nil {
+		return nil, fmt.Errorf("failed to read item: %w", err)
+	}
+
+	fields, _ := item["fields"].([]interface{})
+	sections, _ := item["sections"].([]interface{})
+
+	// Section labels by ID, since fields only reliably carry the section ID
+	sectionLabels := make(map[string]string)
+	for _, s := range sections {
+		if section, ok := s.(map[string]interface{}); ok {
+			id, _ := section["id"].(string)
+			label, _ := section["label"].(string)
+			sectionLabels[id] = label
+		}
+	}
+
+	fieldSection := func(field map[string]interface{}) string {
+		section, ok := field["section"].(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if id, _ := section["id"].(string); sectionLabels[id] != "" {
+			return sectionLabels[id]
+		}
+		label, _ := section["label"].(string)
+		return label
+	}
+
+	findField := func(label, section string) int {
+		for i, f := range fields {
+			field, ok := f.(map[string]interface{})
+			if !ok || field["id"] == "notesPlain" {
+				continue
+			}
+			if field["label"] == label && fieldSection(field) == section {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if notes != nil {
+		for _, f := range fields {
+			if field, ok := f.(map[string]interface{}); ok && field["id"] == "notesPlain" {
+				field["value"] = *notes
+			}
+		}
+	}
+
+	for _, removal := range removals {
+		if i := findField(removal.Label, sectionLabel(removal.Section)); i >= 0 {
+			fields = append(fields[:i], fields[i+1:]...)
+		}
+	}
+
+	for _, upsert := range upserts {
+		section := sectionLabel(upsert.Section)
+		if i := findField(upsert.Label, section); i >= 0 {
+			field := fields[i].(map[string]interface{})
+			field["type"] = upsert.Type
+			field["value"] = upsert.Value
+			continue
+		}
+
+		field := map[string]interface{}{
+			"type":  upsert.Type,
+			"label": upsert.Label,
+			"value": upsert.Value,
+		}
+		if section != "" {
+			id := ""
+			for sectionID, label := range sectionLabels {
+				if label == section {
+					id = sectionID
+					break
+				}
+			}
+			if id == "" {
+				id = newSectionID()
+				sectionLabels[id] = section
+				sections = append(sections, map[string]interface{}{"id": id, "label": section})
+			}
+			field["section"] = map[string]interface{}{"id": id, "label": section}
+		}
+		fields = append(fields, field)
+	}
+
+	// Drop sections that no longer hold any field
+	used := make(map[string]bool)
+	for _, f := range fields {
+		if field, ok := f.(map[string]interface{}); ok {
+			if section, ok := field["section"].(map[string]interface{}); ok {
+				id, _ := section["id"].(string)
+				used[id] = true
+			}
+		}
+	}
+	var keptSections []interface{}
+	for _, s := range sections {
+		if section, ok := s.(map[string]interface{}); ok {
+			if id, _ := section["id"].(string); used[id] {
+				keptSections = append(keptSections, section)
+			}
+		}
+	}
+
+	item["fields"] = fields
+	if keptSections != nil {
+		item["sections"] = keptSections
+	} else {
+		delete(item, "sections")
+	}
+
+	return json.Marshal(item)
+}
+
+// newSectionID returns a random ID for a new section, in the style 1Password uses
+func newSectionID() string {
+	b := make([]byte, 13)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
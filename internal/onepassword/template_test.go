@@ -0,0 +1,200 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCreateItemCommandKeepsValuesOutOfArgs(t *testing.T) {
+	fields := []OnePasswordField{
+		{Type: "CONCEALED", Label: "API_KEY", Value: "super-secret-value"},
+		{Type: "STRING", Label: "REDIS_HOST", Value: "redis.internal", Section: map[string]interface{}{"label": "Redis"}},
+	}
+
+	cmd, err := NewCLI().createItemCommand("Environments", "myapp", "secret notes", fields)
+	if err != nil {
+		t.Fatalf("createItemCommand failed: %v", err)
+	}
+
+	for _, arg := range cmd.Args {
+		for _, secret := range []string{"super-secret-value", "redis.internal", "secret notes"} {
+			if strings.Contains(arg, secret) {
+				t.Errorf("Argument %q leaks value %q", arg, secret)
+			}
+		}
+	}
+
+	stdin, err := io.ReadAll(cmd.Stdin)
+	if err != nil {
+		t.Fatalf("Failed to read stdin: %v", err)
+	}
+
+	var tmpl itemTemplate
+	if err := json.Unmarshal(stdin, &tmpl); err != nil {
+		t.Fatalf("Stdin is not a valid item template: %v", err)
+	}
+
+	if tmpl.Title != "myapp" || tmpl.Category != "SECURE_NOTE" {
+		t.Errorf("Unexpected title/category: %q/%q", tmpl.Title, tmpl.Category)
+	}
+	if len(tmpl.Sections) != 1 || tmpl.Sections[0].Label != "Redis" {
+		t.Fatalf("Expected one Redis section, got %+v", tmpl.Sections)
+	}
+
+	values := make(map[string]templateField)
+	for _, field := range tmpl.Fields {
+		values[field.Label] = field
+	}
+	if values["notesPlain"].Value != "secret notes" || values["notesPlain"].Purpose != "NOTES" {
+		t.Errorf("Unexpected notes field: %+v", values["notesPlain"])
+	}
+	if values["API_KEY"].Value != "super-secret-value" || values["API_KEY"].Type != "CONCEALED" {
+		t.Errorf("Unexpected API_KEY field: %+v", values["API_KEY"])
+	}
+	if section := values["REDIS_HOST"].Section; section == nil || section.ID != tmpl.Sections[0].ID {
+		t.Errorf("REDIS_HOST should reference the Redis section, got %+v", section)
+	}
+}
+
+func TestEditItemTemplate(t *testing.T) {
+	current := `{
+		"id": "abc123",
+		"title": "myapp",
+		"category": "SECURE_NOTE",
+		"tags": ["keep-me"],
+		"sections": [{"id": "s1", "label": "Redis"}, {"id": "s2", "label": "Old"}],
+		"fields": [
+			{"id": "notesPlain", "type": "STRING", "purpose": "NOTES", "label": "notesPlain", "value": "old notes"},
+			{"id": "f1", "type": "CONCEALED", "label": "API_KEY", "value": "old"},
+			{"id": "f2", "type": "STRING", "label": "REDIS_HOST", "value": "localhost", "section": {"id": "s1"}},
+			{"id": "f3", "type": "STRING", "label": "LEGACY", "value": "x", "section": {"id": "s2", "label": "Old"}}
+		]
+	}`
+
+	notes := "new notes"
+	upserts := []OnePasswordField{
+		{Type: "CONCEALED", Label: "API_KEY", Value: "new"},
+		{Type: "STRING", Label: "REDIS_PORT", Value: "6379", Section: map[string]interface{}{"label": "Redis"}},
+		{Type: "STRING", Label: "SMTP_HOST", Value: "smtp", Section: map[string]interface{}{"label": "Email"}},
+	}
+	removals := []OnePasswordField{
+		{Label: "LEGACY", Section: map[string]interface{}{"label": "Old"}},
+	}
+
+	output, err := editItemTemplate([]byte(current), &notes, upserts, removals)
+	if err != nil {
+		t.Fatalf("editItemTemplate failed: %v", err)
+	}
+
+	var item struct {
+		ID       string            `json:"id"`
+		Tags     []string          `json:"tags"`
+		Sections []templateSection `json:"sections"`
+		Fields   []templateField   `json:"fields"`
+	}
+	if err := json.Unmarshal(output, &item); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+
+	if item.ID != "abc123" || len(item.Tags) != 1 {
+		t.Errorf("Unmodelled properties should survive, got id %q tags %v", item.ID, item.Tags)
+	}
+
+	sectionIDs := make(map[string]string)
+	for _, section := range item.Sections {
+		sectionIDs[section.Label] = section.ID
+	}
+	if _, exists := sectionIDs["Old"]; exists {
+		t.Error("Empty section Old should have been dropped")
+	}
+	if sectionIDs["Redis"] != "s1" || sectionIDs["Email"] == "" {
+		t.Errorf("Unexpected sections: %+v", item.Sections)
+	}
+
+	fields := make(map[string]templateField)
+	for _, field := range item.Fields {
+		fields[field.Label] = field
+	}
+	if len(fields) != 5 {
+		t.Errorf("Expected 5 fields, got %d: %+v", len(fields), item.Fields)
+	}
+	if fields["notesPlain"].Value != "new notes" {
+		t.Errorf("Notes not updated: %+v", fields["notesPlain"])
+	}
+	if fields["API_KEY"].Value != "new" || fields["API_KEY"].ID != "f1" {
+		t.Errorf("API_KEY should be updated in place: %+v", fields["API_KEY"])
+	}
+	if fields["REDIS_PORT"].Section == nil || fields["REDIS_PORT"].Section.ID != "s1" {
+		t.Errorf("REDIS_PORT should join the existing Redis section: %+v", fields["REDIS_PORT"])
+	}
+	if fields["SMTP_HOST"].Section == nil || fields["SMTP_HOST"].Section.ID != sectionIDs["Email"] {
+		t.Errorf("SMTP_HOST should reference the new Email section: %+v", fields["SMTP_HOST"])
+	}
+}
+
+func TestItemTemplateSpecialCharacters(t *testing.T) {
+	fields := []OnePasswordField{
+		{Type: "STRING", Label: "CONNECTION", Value: "host=db;user=app"},
+		{Type: "CONCEALED", Label: "MIXED", Value: `x.y[z]=\w`, Section: map[string]interface{}{"label": "v1.2 Settings"}},
+		{Type: "STRING", Label: "PLAIN", Value: "value", Section: map[string]interface{}{"label": `Weird = [Section] \ Name`}},
+	}
+
+	output, err := newItemTemplate("my.app[1]", `notes with = and \`, fields)
+	if err != nil {
+		t.Fatalf("newItemTemplate failed: %v", err)
+	}
+
+	var tmpl itemTemplate
+	if err := json.Unmarshal(output, &tmpl); err != nil {
+		t.Fatalf("Template is not valid JSON: %v", err)
+	}
+
+	if tmpl.Title != "my.app[1]" {
+		t.Errorf("Title mismatch: %q", tmpl.Title)
+	}
+	if tmpl.Fields[0].Value != `notes with = and \` {
+		t.Errorf("Notes mismatch: %q", tmpl.Fields[0].Value)
+	}
+
+	sections := make(map[string]string)
+	for _, section := range tmpl.Sections {
+		sections[section.ID] = section.Label
+	}
+
+	for i, field := range fields {
+		got := tmpl.Fields[i+1]
+		if got.Label != field.Label || got.Value != field.Value {
+			t.Errorf("Field %d mismatch: expected %s=%q, got %s=%q", i, field.Label, field.Value, got.Label, got.Value)
+		}
+
+		want := sectionLabel(field.Section)
+		section := ""
+		if got.Section != nil {
+			section = sections[got.Section.ID]
+		}
+		if section != want {
+			t.Errorf("Field %s section mismatch: expected %q, got %q", field.Label, want, section)
+		}
+	}
+
+	// Edits must round-trip the same characters
+	edited, err := editItemTemplate(output, nil, []OnePasswordField{
+		{Type: "STRING", Label: "PLAIN", Value: "a=b]", Section: map[string]interface{}{"label": `Weird = [Section] \ Name`}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("editItemTemplate failed: %v", err)
+	}
+
+	var editedTmpl itemTemplate
+	if err := json.Unmarshal(edited, &editedTmpl); err != nil {
+		t.Fatalf("Edited template is not valid JSON: %v", err)
+	}
+	if len(editedTmpl.Fields) != len(tmpl.Fields) {
+		t.Fatalf("Edit should update PLAIN in place, got %d fields", len(editedTmpl.Fields))
+	}
+	if got := editedTmpl.Fields[3]; got.Label != "PLAIN" || got.Value != "a=b]" {
+		t.Errorf("Edited field mismatch: %+v", got)
+	}
+}
@@ -2,16 +2,19 @@ package onepassword
 
 // OnePasswordItem represents a 1Password item structure
 type OnePasswordItem struct {
-	ID     string                 `json:"id"`
-	Title  string                 `json:"title"`
-	Fields []OnePasswordField     `json:"fields"`
-	Vault  map[string]interface{} `json:"vault"`
+	ID        string                 `json:"id"`
+	Title     string                 `json:"title"`
+	Version   int                    `json:"version,omitempty"`    // incremented by 1Password on every edit
+	UpdatedAt string                 `json:"updated_at,omitempty"` // RFC 3339 time of the last edit
+	Fields    []OnePasswordField     `json:"fields"`
+	Vault     map[string]interface{} `json:"vault"`
 }
 
 // OnePasswordField represents a field within a 1Password item
 type OnePasswordField struct {
 	ID      string                 `json:"id"`
 	Type    string                 `json:"type"`
+	Purpose string                 `json:"purpose,omitempty"` // set on built-in fields such as notes or passwords
 	Label   string                 `json:"label"`
 	Value   string                 `json:"value"`
 	Section map[string]interface{} `json:"section,omitempty"`
@@ -27,4 +30,13 @@ type VaultInfo struct {
 type ItemInfo struct {
 	ID    string `json:"id"`
 	Title string `json:"title"`
-}
\ No newline at end of file
+}
+
+// sectionLabel returns the label of a field section, or "" for no section
+func sectionLabel(section map[string]interface{}) string {
+	if section == nil {
+		return ""
+	}
+	label, _ := section["label"].(string)
+	return label
+}
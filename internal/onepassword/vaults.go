@@ -3,12 +3,12 @@ package onepassword
 import (
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"strings"
 )
 
 // ListVaults returns all available vaults
-func ListVaults() ([]VaultInfo, error) {
-	cmd := exec.Command("op", "vault", "list", "--format", "json")
+func (c *CLI) ListVaults() ([]VaultInfo, error) {
+	cmd := c.command("vault", "list", "--format", "json")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, err
@@ -24,8 +24,8 @@ func ListVaults() ([]VaultInfo, error) {
 }
 
 // CreateVault creates a new vault
-func CreateVault(vaultName string) error {
-	cmd := exec.Command("op", "vault", "create", vaultName)
+func (c *CLI) CreateVault(vaultName string) error {
+	cmd := c.command("vault", "create", vaultName)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to create vault: %s", string(output))
@@ -33,31 +33,59 @@ func CreateVault(vaultName string) error {
 	return nil
 }
 
-// GetVaultIdentifier returns the vault ID if there are multiple vaults with the same name,
-// otherwise returns the vault name
-func GetVaultIdentifier(vaultName string) (string, error) {
-	vaults, err := ListVaults()
+// VaultNotFoundError is returned for a vault that no vault has the name or ID of
+type VaultNotFoundError struct {
+	Vault string
+}
+
+func (e *VaultNotFoundError) Error() string {
+	return fmt.Sprintf("vault '%s' not found", e.Vault)
+}
+
+// AmbiguousVaultError is returned for a name that several vaults have
+type AmbiguousVaultError struct {
+	Name   string
+	Vaults []VaultInfo
+}
+
+func (e *AmbiguousVaultError) Error() string {
+	return fmt.Sprintf("%d vaults are named '%s'", len(e.Vaults), e.Name)
+}
+
+// GetVaultIdentifier returns the ID of the vault with the given ID or name. A
+// name that several vaults have is an *AmbiguousVaultError listing them, and one
+// that no vault has a *VaultNotFoundError.
+func GetVaultIdentifier(backend Backend, vault string) (string, error) {
+	vaults, err := backend.ListVaults()
 	if err != nil {
 		return "", fmt.Errorf("failed to list vaults: %w", err)
 	}
-	
+
 	var matchingVaults []VaultInfo
 	for _, v := range vaults {
-		if v.Name == vaultName {
+		if v.ID == vault {
+			return v.ID, nil
+		}
+		if v.Name == vault {
 			matchingVaults = append(matchingVaults, v)
 		}
 	}
-	
-	if len(matchingVaults) == 0 {
-		return "", fmt.Errorf("vault '%s' not found", vaultName)
+
+	switch len(matchingVaults) {
+	case 0:
+		return "", &VaultNotFoundError{Vault: vault}
+	case 1:
+		return matchingVaults[0].ID, nil
 	}
-	
-	if len(matchingVaults) == 1 {
-		// Only one vault with this name, can use name
-		return vaultName, nil
+	return "", &AmbiguousVaultError{Name: vault, Vaults: matchingVaults}
+}
+
+// SplitVaultAccount splits a vault given as name@account, for a vault of another
+// account than the default one. The account is "" if there is none. Vault names
+// may have an @ too, so callers look for the whole name first.
+func SplitVaultAccount(vault string) (name, account string) {
+	if i := strings.LastIndex(vault, "@"); i > 0 && i < len(vault)-1 {
+		return vault[:i], vault[i+1:]
 	}
-	
-	// Multiple vaults with same name, need to pick one or ask user
-	// For now, return the first one's ID
-	return matchingVaults[0].ID, nil
-}
\ No newline at end of file
+	return vault, ""
+}
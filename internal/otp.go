@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// totpCode returns the TOTP code (RFC 6238) of an OTP field value at a given time.
+// The value is an otpauth:// URI or a bare base32 secret, like 1Password accepts.
+func totpCode(seed string, now time.Time) (string, error) {
+	secret, digits, period, algorithm := seed, 6, 30, "SHA1"
+
+	if strings.HasPrefix(seed, "otpauth://") {
+		u, err := url.Parse(seed)
+		if err != nil {
+			return "", fmt.Errorf("invalid otpauth URI: %w", err)
+		}
+		query := u.Query()
+		secret = query.Get("secret")
+		if value := query.Get("digits"); value != "" {
+			if digits, err = strconv.Atoi(value); err != nil || digits < 6 || digits > 10 {
+				return "", fmt.Errorf("invalid otpauth digits %q", value)
+			}
+		}
+		if value := query.Get("period"); value != "" {
+			if period, err = strconv.Atoi(value); err != nil || period <= 0 {
+				return "", fmt.Errorf("invalid otpauth period %q", value)
+			}
+		}
+		if value := query.Get("algorithm"); value != "" {
+			algorithm = strings.ToUpper(value)
+		}
+	}
+
+	var newHash func() hash.Hash
+	switch algorithm {
+	case "SHA1":
+		newHash = sha1.New
+	case "SHA256":
+		newHash = sha256.New
+	case "SHA512":
+		newHash = sha512.New
+	default:
+		return "", fmt.Errorf("unsupported otpauth algorithm %q", algorithm)
+	}
+
+	secret = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return "", fmt.Errorf("invalid OTP secret")
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix())/uint64(period))
+	mac := hmac.New(newHash, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint64(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, uint64(code)%mod), nil
+}
+
+// isTOTPCode reports whether an OTP field value is a code written by
+// `pull --otp code` rather than a seed. Codes are short and all digits, which
+// no otpauth URI or base32 secret is.
+func isTOTPCode(value string) bool {
+	if len(value) < 6 || len(value) > 10 {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// withTOTPCodes returns a copy of an item with the seed of each OTP field
+// replaced by its current code
+func withTOTPCodes(item *onepassword.OnePasswordItem, now time.Time) (*onepassword.OnePasswordItem, error) {
+	coded := *item
+	coded.Fields = append([]onepassword.OnePasswordField(nil), item.Fields...)
+
+	for i, field := range coded.Fields {
+		if field.Type != "OTP" || field.Value == "" {
+			continue
+		}
+		code, err := totpCode(field.Value, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the code of %s: %w", field.Label, err)
+		}
+		coded.Fields[i].Value = code
+	}
+	return &coded, nil
+}
+
+// restoreOTPSeeds puts the seeds of an item back in place of the TOTP codes a
+// .env file holds after `pull --otp code`, so that codes are never pushed and
+// don't count as local changes. It returns the OTP fields it couldn't restore.
+func restoreOTPSeeds(local, remote *onepassword.OnePasswordItem) []string {
+	seeds := make(map[string]string)
+	if remote != nil {
+		for _, field := range envFields(remote) {
+			if field.Type == "OTP" {
+				seeds[field.Label] = field.Value
+			}
+		}
+	}
+
+	var missing []string
+	for i, field := range local.Fields {
+		if field.Type != "OTP" || !isTOTPCode(field.Value) {
+			continue
+		}
+		if seed, ok := seeds[field.Label]; ok {
+			local.Fields[i].Value = seed
+		} else {
+			missing = append(missing, field.Label)
+		}
+	}
+	return missing
+}
@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"regexp"
@@ -10,105 +9,164 @@ import (
 	"github.com/scriptogre/op-dotenv/internal/onepassword"
 )
 
-// getFieldType determines if a field should be a password based on its name
+// getFieldType determines if a field should be a password based on its name,
+// using the default concealment rules
 func getFieldType(fieldName string) string {
-	// Keywords that indicate a field should be hidden as a password
-	passwordKeywords := []string{"PASSWORD", "PASS", "SECRET", "KEY", "TOKEN", "AUTH", "CREDENTIAL", "HASH", "SALT"}
-	
-	upperName := strings.ToUpper(fieldName)
-	for _, keyword := range passwordKeywords {
-		if strings.Contains(upperName, keyword) {
-			return "CONCEALED"
-		}
-	}
-	
-	return "STRING"
+	return defaultConcealer.fieldType(fieldName)
 }
 
-// ParseEnvFileToItem reads a .env file and converts it to a OnePasswordItem structure
+// ParseEnvFileToItem reads a .env file and converts it to a OnePasswordItem structure.
+// Lines that can't be parsed are all reported in a *ParseError.
 func ParseEnvFileToItem(filePath, itemTitle string) (*onepassword.OnePasswordItem, error) {
-	file, err := os.Open(filePath)
+	return parseEnvFile(filePath, itemTitle, defaultConcealer)
+}
+
+// parseEnvFile is ParseEnvFileToItem with the concealment rules of the project.
+// An `# op:concealed` or `# op:text` comment after a variable, or on the line
+// above it, overrides the rules for that variable.
+//
+// Sections start at `## Section` lines. In files without any, a comment line
+// after a blank line (or at the top of the file) starts a section instead.
+// Other comment lines right above a variable describe it.
+func parseEnvFile(filePath, itemTitle string, conceal *concealer) (*onepassword.OnePasswordItem, error) {
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
 	item := &onepassword.OnePasswordItem{
 		Title:  itemTitle,
 		Fields: []onepassword.OnePasswordField{},
 	}
 
-	scanner := bufio.NewScanner(file)
+	entries, err := lexDotenv(string(data))
+	if err != nil {
+		return nil, err
+	}
+
 	currentSection := ""
+	annotated := "" // field type asked for by an annotation line above the next variable
 	inHeader := false
 	headerLines := []string{}
+	var descriptions []onepassword.OnePasswordField
 
-	// Regex patterns
-	headerStartPattern := regexp.MustCompile(`^#\s*-+\s*$`)
-	sectionPattern := regexp.MustCompile(`^#\s*(.+)\s*$`)
-	varPattern := regexp.MustCompile(`^([A-Z_][A-Z0-9_]*)=(.*)$`)
+	marked := false
+	for _, entry := range entries {
+		if entry.Kind == entryComment && markedSectionPattern.MatchString(entry.Comment) {
+			marked = true
+		}
+	}
+	afterBlank := true // at the top of the file, or after a blank line
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	// The layout keeps every line. Comment lines wait for the variable they
+	// may describe, and are kept as they are if a blank line comes first.
+	layout := newLayout(string(data))
+	var above []string
+	var header []string
+	flushAbove := func() {
+		for _, line := range above {
+			layout.Lines = append(layout.Lines, layoutLine{Text: line})
+		}
+		above = nil
+	}
+
+	for _, entry := range entries {
+		blank := afterBlank
+		afterBlank = entry.Kind == entryBlank
 
 		// Skip empty lines
-		if line == "" {
+		if entry.Kind == entryBlank {
+			annotated = ""
+			flushAbove()
+			if inHeader {
+				header = append(header, entry.Raw)
+			} else {
+				layout.Lines = append(layout.Lines, layoutLine{Text: entry.Raw})
+			}
 			continue
 		}
 
-		// Check for header start (lines with dashes)
-		if headerStartPattern.MatchString(line) {
-			if !inHeader {
-				inHeader = true
+		if entry.Kind == entryComment {
+			line := entry.Comment
+
+			// Check for header start (lines with dashes)
+			if headerStartPattern.MatchString(line) {
+				flushAbove()
+				header = append(header, entry.Raw)
+				if inHeader {
+					layout.Lines = append(layout.Lines, layoutLine{Text: strings.Join(header, "\n"), Notes: true})
+					header = nil
+				}
+				inHeader = !inHeader
 				continue
-			} else {
-				inHeader = false
+			}
+
+			// If we're in header, collect notes
+			if inHeader {
+				headerLines = append(headerLines, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+				header = append(header, entry.Raw)
 				continue
 			}
-		}
 
-		// If we're in header, collect notes
-		if inHeader {
-			if strings.HasPrefix(line, "#") {
-				headerLines = append(headerLines, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#")))
+			// Annotations apply to the variable below, they aren't sections
+			if fieldType := annotatedType(line); fieldType != "" {
+				annotated = fieldType
+				above = append(above, entry.Raw)
+				continue
 			}
-			continue
-		}
 
-		// Check for section header
-		if strings.HasPrefix(line, "#") && !headerStartPattern.MatchString(line) {
+			// Check for section header
 			matches := sectionPattern.FindStringSubmatch(line)
-			if len(matches) > 1 {
-				currentSection = strings.TrimSpace(matches[1])
+			if marked {
+				matches = markedSectionPattern.FindStringSubmatch(line)
+			} else if !blank {
+				matches = nil
+			}
+			if matches == nil {
+				above = append(above, entry.Raw)
 				continue
 			}
+			flushAbove()
+			currentSection = strings.TrimSpace(matches[1])
+			layout.Lines = append(layout.Lines, layoutLine{Text: entry.Raw, Heading: currentSection})
+			continue
 		}
 
-		// Check for variable
-		matches := varPattern.FindStringSubmatch(line)
-		if len(matches) > 2 {
-			key := matches[1]
-			value := strings.Trim(matches[2], `'"`)
+		layout.Lines = append(layout.Lines, layoutLine{
+			Key:     entry.Key,
+			Section: currentSection,
+			Above:   strings.Join(above, "\n"),
+			Prefix:  entry.Prefix,
+			Quote:   entry.Quote,
+			Escapes: entry.Escapes,
+			Suffix:  entry.Suffix,
+		})
 
-			field := onepassword.OnePasswordField{
-				Type:  getFieldType(key),
-				Label: key,
-				Value: value,
-			}
+		field := onepassword.OnePasswordField{
+			Type:  conceal.valueType(entry.Key, entry.Value),
+			Label: entry.Key,
+			Value: entry.Value,
+		}
+		if fieldType := annotatedType(entry.Comment); fieldType != "" {
+			field.Type = fieldType
+		} else if annotated != "" {
+			field.Type = annotated
+		}
+		annotated = ""
 
-			// Add section if we're in one
-			if currentSection != "" {
-				field.Section = map[string]interface{}{
-					"label": currentSection,
-				}
-			}
+		if description := describedAs(descriptionLines(above)); description != "" {
+			descriptions = append(descriptions, descriptionField(entry.Key, description))
+		}
+		above = nil
 
-			item.Fields = append(item.Fields, field)
+		// Add section if we're in one
+		if currentSection != "" {
+			field.Section = map[string]interface{}{
+				"label": currentSection,
+			}
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		item.Fields = append(item.Fields, field)
 	}
 
 	// Add notes as a special field if present
@@ -121,12 +179,82 @@ func ParseEnvFileToItem(filePath, itemTitle string) (*onepassword.OnePasswordIte
 		}
 		item.Fields = append(item.Fields, notesField)
 	}
+	item.Fields = append(item.Fields, descriptions...)
+
+	// An unterminated header runs to the end of the file
+	flushAbove()
+	if len(header) > 0 {
+		layout.Lines = append(layout.Lines, layoutLine{Text: strings.Join(header, "\n"), Notes: true})
+	}
+	item.Fields = append(item.Fields, layout.field())
 
 	return item, nil
 }
 
+// descriptionLines returns the comment lines above a variable that describe it,
+// leaving out its annotation
+func descriptionLines(above []string) []string {
+	var lines []string
+	for _, line := range above {
+		if annotatedType(strings.TrimSpace(line)) == "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+var (
+	headerStartPattern   = regexp.MustCompile(`^#\s*-+\s*$`)
+	sectionPattern       = regexp.MustCompile(`^#\s*(.+)\s*$`)
+	markedSectionPattern = regexp.MustCompile(`^##(\s.*)?$`) // "##" alone ends a section
+)
+
+// quoteEnvValue picks the quoting that lets lexDotenv read value back unchanged.
+// Empty values are written bare. Other values are single-quoted (taken literally)
+// unless they contain a single quote, a line break or a ${VAR} reference, in
+// which case they are double-quoted with escapes.
+func quoteEnvValue(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	if !strings.ContainsAny(value, "'\n\r") && !strings.Contains(value, "${") {
+		return "'" + value + "'"
+	}
+
+	escaper := strings.NewReplacer("$${", `\${`, `\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + escaper.Replace(value) + `"`
+}
+
 // WriteItemToEnvFile converts a OnePasswordItem to a .env file
 func WriteItemToEnvFile(filePath string, item *onepassword.OnePasswordItem) error {
+	return writeMergedEnvFile(filePath, item, nil, defaultConcealer)
+}
+
+// writeMergedEnvFile writes an item to a .env file. Variables (or notes) listed in
+// conflicts are written as a conflict block holding both versions, which the
+// parser rejects until it is resolved by hand. Variables whose field type differs
+// from what the concealment rules give them are annotated to keep it, and their
+// descriptions go on the lines above them.
+func writeMergedEnvFile(filePath string, item *onepassword.OnePasswordItem, conflicts map[string]MergeConflict, conceal *concealer) error {
+	descriptions := itemDescriptions(item)
+	envLine := func(field onepassword.OnePasswordField) string {
+		line := fmt.Sprintf("%s=%s", field.Label, quoteEnvValue(field.Value))
+		if annotation := conceal.annotation(field.Label, field.Value, field.Type); annotation != "" {
+			line += " " + annotation
+		}
+		return descriptionComment(descriptions[field.Label]) + line + "\n"
+	}
+
+	// Files pushed with a layout are written back the way they were
+	if layout := parseLayout(item); layout != nil {
+		content, err := layout.render(item, conflicts, conceal, envLine)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filePath, []byte(content), 0644)
+	}
+
 	file, err := os.Create(filePath)
 	if err != nil {
 		return err
@@ -145,7 +273,7 @@ func WriteItemToEnvFile(filePath string, item *onepassword.OnePasswordItem) erro
 			continue
 		}
 
-		if field.Value == "" {
+		if !isEnvField(field) {
 			continue
 		}
 
@@ -166,14 +294,10 @@ func WriteItemToEnvFile(filePath string, item *onepassword.OnePasswordItem) erro
 	}
 
 	// Write header with notes if present
-	if notes != "" {
-		file.WriteString("# " + strings.Repeat("-", 44) + "\n")
-		for _, line := range strings.Split(notes, "\n") {
-			if strings.TrimSpace(line) != "" {
-				file.WriteString("# " + line + "\n")
-			}
-		}
-		file.WriteString("# " + strings.Repeat("-", 44) + "\n\n")
+	if conflict, exists := conflicts["notesPlain"]; exists {
+		file.WriteString(conflictBlock(conflict, notesHeader) + "\n")
+	} else if notes != "" {
+		file.WriteString(notesHeader(onepassword.OnePasswordField{Value: notes}) + "\n")
 	}
 
 	// Prepare named sections list
@@ -184,10 +308,24 @@ func WriteItemToEnvFile(filePath string, item *onepassword.OnePasswordItem) erro
 		}
 	}
 
+	// A description at the top would be read as a section heading, unless
+	// sections start with ## lines
+	heading := "# "
+	if fields := sections[""]; len(fields) > 0 && descriptions[fields[0].Label] != "" && conflicts[fields[0].Label].Label == "" {
+		heading = "## "
+		if len(namedSections) == 0 {
+			file.WriteString("##\n")
+		}
+	}
+
 	// Write ungrouped variables first (empty section key)
 	if fields, exists := sections[""]; exists && len(fields) > 0 {
 		for _, field := range fields {
-			file.WriteString(fmt.Sprintf("%s='%s'\n", field.Label, field.Value))
+			if conflict, exists := conflicts[field.Label]; exists {
+				file.WriteString(conflictBlock(conflict, envLine))
+			} else {
+				file.WriteString(envLine(field))
+			}
 		}
 		// Only add newline if there are named sections to follow
 		if len(namedSections) > 0 {
@@ -199,9 +337,13 @@ func WriteItemToEnvFile(filePath string, item *onepassword.OnePasswordItem) erro
 	for i, sectionName := range namedSections {
 		fields := sections[sectionName]
 		if len(fields) > 0 {
-			file.WriteString(fmt.Sprintf("# %s\n", sectionName))
+			file.WriteString(heading + sectionName + "\n")
 			for _, field := range fields {
-				file.WriteString(fmt.Sprintf("%s='%s'\n", field.Label, field.Value))
+				if conflict, exists := conflicts[field.Label]; exists {
+					file.WriteString(conflictBlock(conflict, envLine))
+				} else {
+					file.WriteString(envLine(field))
+				}
 			}
 			// Only add newline if not the last section
 			if i < len(namedSections)-1 {
@@ -212,3 +354,32 @@ func WriteItemToEnvFile(filePath string, item *onepassword.OnePasswordItem) erro
 
 	return nil
 }
+
+// notesHeader formats notes as the comment block heading a .env file
+func notesHeader(field onepassword.OnePasswordField) string {
+	var b strings.Builder
+	b.WriteString("# " + strings.Repeat("-", 44) + "\n")
+	for _, line := range strings.Split(field.Value, "\n") {
+		if strings.TrimSpace(line) != "" {
+			b.WriteString("# " + line + "\n")
+		}
+	}
+	b.WriteString("# " + strings.Repeat("-", 44) + "\n")
+	return b.String()
+}
+
+// conflictBlock formats both versions of a conflicting variable between
+// git-style markers. A side that deleted the variable is left empty.
+func conflictBlock(conflict MergeConflict, format func(onepassword.OnePasswordField) string) string {
+	var b strings.Builder
+	b.WriteString("<<<<<<< local\n")
+	if conflict.Local != nil {
+		b.WriteString(format(*conflict.Local))
+	}
+	b.WriteString("=======\n")
+	if conflict.Remote != nil {
+		b.WriteString(format(*conflict.Remote))
+	}
+	b.WriteString(">>>>>>> 1Password\n")
+	return b.String()
+}
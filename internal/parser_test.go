@@ -27,6 +27,36 @@ func TestGetFieldType(t *testing.T) {
 		{"REDIS_HOST", "STRING"},
 		{"PORT", "STRING"},
 		{"DEBUG", "STRING"},
+		{"MONKEY_COUNT", "STRING"},
+		{"PASSENGER_LIMIT", "STRING"},
+		{"AUTHOR", "STRING"},
+		{"SENTRY_DSN", "CONCEALED"},
+		{"PRIVATE_PEM", "CONCEALED"},
+		{"api.key", "CONCEALED"},
+		{"DBPASSWORD", "CONCEALED"},
+		{"GITHUBTOKEN", "CONCEALED"},
+		{"ACCESSTOKEN", "CONCEALED"},
+		{"MYSQL_ROOTPASSWORD", "CONCEALED"},
+		{"STRIPESECRETKEY", "CONCEALED"},
+		{"dbPassword", "CONCEALED"},
+		{"githubToken", "CONCEALED"},
+		{"apiKey", "CONCEALED"},
+		{"DBPASS", "CONCEALED"},
+		{"MYSQLPASS", "CONCEALED"},
+		{"APPKEY", "CONCEALED"},
+		{"JWTKEY", "CONCEALED"},
+		{"SIGNINGKEY", "CONCEALED"},
+		{"STRIPEKEY", "CONCEALED"},
+		{"SSHKEY", "CONCEALED"},
+		{"ENCRYPTIONKEY", "CONCEALED"},
+		{"MASTERKEY", "CONCEALED"},
+		{"HMACKEY", "CONCEALED"},
+		{"AUTHKEY", "CONCEALED"},
+		{"PASSKEY", "CONCEALED"},
+		{"DB_PW", "CONCEALED"},
+		{"SENTRYDSN", "CONCEALED"},
+		{"monkeyCount", "STRING"},
+		{"authorName", "STRING"},
 	}
 
 	for _, tt := range tests {
@@ -77,8 +107,8 @@ SMTP_USER=user@example.com
 		t.Errorf("Expected title 'test-item', got %q", item.Title)
 	}
 
-	// Check that we have the expected number of fields (7 env vars + notes)
-	expectedFieldCount := 8
+	// Check that we have the expected number of fields (7 env vars + notes + layout)
+	expectedFieldCount := 9
 	if len(item.Fields) != expectedFieldCount {
 		t.Errorf("Expected %d fields, got %d", expectedFieldCount, len(item.Fields))
 	}
@@ -112,7 +142,7 @@ SMTP_USER=user@example.com
 	}
 
 	for _, field := range item.Fields {
-		if field.ID == "notesPlain" {
+		if field.ID == "notesPlain" || isLayoutField(field) {
 			continue
 		}
 
@@ -247,16 +277,17 @@ func TestCommentSpacingAndNewlines(t *testing.T) {
 
 TEST_VAR=value`,
 			wantSpacing: "# This is a test comment",
-			wantLines:   1, // Should end with single newline
+			wantLines:   0, // No final newline, as in the file
 		},
 		{
-			name: "multiple spaces in comments should be normalized",
+			name: "multiple spaces in comments are kept",
 			envContent: `# --------------------------------------------
 #   This has extra spaces
 # --------------------------------------------
 
-TEST_VAR=value`,
-			wantSpacing: "# This has extra spaces",
+TEST_VAR=value
+`,
+			wantSpacing: "#   This has extra spaces",
 			wantLines:   1,
 		},
 		{
@@ -265,9 +296,11 @@ TEST_VAR=value`,
 # Short dashes
 # ---
 
-TEST_VAR=value`,
+TEST_VAR=value
+
+`,
 			wantSpacing: "# Short dashes",
-			wantLines:   1,
+			wantLines:   2, // Trailing blank lines are kept
 		},
 	}
 
@@ -478,13 +511,13 @@ REDIS_PORT=6379`
 	fieldMap2 := make(map[string]onepassword.OnePasswordField)
 	
 	for _, field := range item.Fields {
-		if field.ID != "notesPlain" {
+		if field.ID != "notesPlain" && !isLayoutField(field) {
 			fieldMap1[field.Label] = field
 		}
 	}
 	
 	for _, field := range item2.Fields {
-		if field.ID != "notesPlain" {
+		if field.ID != "notesPlain" && !isLayoutField(field) {
 			fieldMap2[field.Label] = field
 		}
 	}
@@ -560,7 +593,7 @@ DEBUG=true`
 	}
 
 	for _, field := range item.Fields {
-		if field.ID == "notesPlain" {
+		if field.ID == "notesPlain" || isLayoutField(field) {
 			continue
 		}
 		
@@ -701,4 +734,415 @@ func slicesEqual(a, b []string) bool {
 		}
 	}
 	return true
-}
\ No newline at end of file
+}
+
+func TestRoundTripSpecialCharacters(t *testing.T) {
+	// These characters are part of op's `section.label[type]=value` assignment
+	// grammar and used to be misparsed when passed as arguments
+	originalEnv := `CONNECTION=host=db;user=app
+BRACKETS=list[0]=value]
+WINDOWS_PATH=C:\Users\app\config
+VERSION=1.2.3
+
+# v1.2 Settings
+DOTTED=a.b.c
+MIXED=x.y[z]=\w
+
+# Weird = [Section] \ Name
+PLAIN=value`
+
+	tmpDir := t.TempDir()
+	originalFile := filepath.Join(tmpDir, "original.env")
+	if err := os.WriteFile(originalFile, []byte(originalEnv), 0644); err != nil {
+		t.Fatalf("Failed to create original .env file: %v", err)
+	}
+
+	item, err := ParseEnvFileToItem(originalFile, "test-item")
+	if err != nil {
+		t.Fatalf("Failed to parse original .env: %v", err)
+	}
+
+	roundTripFile := filepath.Join(tmpDir, "roundtrip.env")
+	if err := WriteItemToEnvFile(roundTripFile, item); err != nil {
+		t.Fatalf("Failed to write round-trip .env: %v", err)
+	}
+
+	item2, err := ParseEnvFileToItem(roundTripFile, "test-item")
+	if err != nil {
+		t.Fatalf("Failed to parse round-trip .env: %v", err)
+	}
+
+	expected := map[string][2]string{
+		"CONNECTION":   {"host=db;user=app", ""},
+		"BRACKETS":     {"list[0]=value]", ""},
+		"WINDOWS_PATH": {`C:\Users\app\config`, ""},
+		"VERSION":      {"1.2.3", ""},
+		"DOTTED":       {"a.b.c", "v1.2 Settings"},
+		"MIXED":        {`x.y[z]=\w`, "v1.2 Settings"},
+		"PLAIN":        {"value", `Weird = [Section] \ Name`},
+	}
+
+	for _, parsed := range []*onepassword.OnePasswordItem{item, item2} {
+		if len(envFields(parsed)) != len(expected) {
+			t.Errorf("Expected %d fields, got %d", len(expected), len(envFields(parsed)))
+		}
+
+		for _, field := range envFields(parsed) {
+			want, exists := expected[field.Label]
+			if !exists {
+				t.Errorf("Unexpected field: %s", field.Label)
+				continue
+			}
+
+			if field.Value != want[0] {
+				t.Errorf("Field %s value mismatch: expected %q, got %q", field.Label, want[0], field.Value)
+			}
+
+			section := ""
+			if field.Section != nil {
+				section, _ = field.Section["label"].(string)
+			}
+			if section != want[1] {
+				t.Errorf("Field %s section mismatch: expected %q, got %q", field.Label, want[1], section)
+			}
+		}
+	}
+}
+
+func TestParseDotenvSyntax(t *testing.T) {
+	envContent := "export EXPORTED=yes\n" +
+		"lower_case=value\n" +
+		"SPACED = around equals \n" +
+		"INLINE=value # a comment\n" +
+		"HASH_IN_VALUE=http://example.com/#anchor\n" +
+		"EMPTY=\n" +
+		"SINGLE='literal \\n $HOME'\n" +
+		"DOUBLE=\"tab\\there \\\"quoted\\\" back\\\\slash\"\n" +
+		"QUOTED_COMMENT=\"value\" # trailing comment\n" +
+		"PEM=\"-----BEGIN KEY-----\n" +
+		"abc\n" +
+		"-----END KEY-----\"\n" +
+		"JSON='{\n" +
+		"  \"a\": 1\n" +
+		"}'\n" +
+		"WINDOWS=crlf\r\n" +
+		"REFERENCE=\"${A}:${B:-x}\"\n" +
+		"LITERAL_REFERENCE='${A}'\n" +
+		"ESCAPED_REFERENCE=\"\\${A}\"\n" +
+		"AFTER=multiline\n"
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(envFile, []byte(envContent), 0644); err != nil {
+		t.Fatalf("Failed to create test .env file: %v", err)
+	}
+
+	item, err := ParseEnvFileToItem(envFile, "test-item")
+	if err != nil {
+		t.Fatalf("ParseEnvFileToItem failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"EXPORTED":          "yes",
+		"lower_case":        "value",
+		"SPACED":            "around equals",
+		"INLINE":            "value",
+		"HASH_IN_VALUE":     "http://example.com/#anchor",
+		"EMPTY":             "",
+		"SINGLE":            `literal \n $HOME`,
+		"DOUBLE":            "tab\there \"quoted\" back\\slash",
+		"QUOTED_COMMENT":    "value",
+		"PEM":               "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"JSON":              "{\n  \"a\": 1\n}",
+		"WINDOWS":           "crlf",
+		"REFERENCE":         "${A}:${B:-x}",
+		"LITERAL_REFERENCE": "$${A}",
+		"ESCAPED_REFERENCE": "$${A}",
+		"AFTER":             "multiline",
+	}
+
+	if len(envFields(item)) != len(expected) {
+		t.Errorf("Expected %d fields, got %d", len(expected), len(envFields(item)))
+	}
+
+	for _, field := range envFields(item) {
+		want, exists := expected[field.Label]
+		if !exists {
+			t.Errorf("Unexpected field: %s", field.Label)
+			continue
+		}
+		if field.Value != want {
+			t.Errorf("Field %s: expected %q, got %q", field.Label, want, field.Value)
+		}
+	}
+}
+
+func TestParseReportsInvalidLines(t *testing.T) {
+	envContent := `VALID=1
+NO_EQUALS
+1INVALID=value
+QUOTED="value" trailing
+ALSO_VALID=2
+UNTERMINATED="never closed
+OTHER=3`
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(envFile, []byte(envContent), 0644); err != nil {
+		t.Fatalf("Failed to create test .env file: %v", err)
+	}
+
+	_, err := ParseEnvFileToItem(envFile, "test-item")
+	if err == nil {
+		t.Fatal("ParseEnvFileToItem should fail on invalid lines")
+	}
+
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected *ParseError, got %T: %v", err, err)
+	}
+
+	var lines []int
+	for _, lineErr := range parseErr.Errors {
+		lines = append(lines, lineErr.Line)
+	}
+
+	wantLines := []int{2, 3, 4, 6}
+	if len(lines) != len(wantLines) {
+		t.Fatalf("Expected errors on lines %v, got %v (%v)", wantLines, lines, err)
+	}
+	for i := range wantLines {
+		if lines[i] != wantLines[i] {
+			t.Errorf("Expected errors on lines %v, got %v", wantLines, lines)
+			break
+		}
+	}
+}
+
+func TestParseRejectsDuplicateKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(envFile, []byte("KEY=first\nOTHER=1\nexport KEY=second\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test .env file: %v", err)
+	}
+
+	_, err := ParseEnvFileToItem(envFile, "test-item")
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected *ParseError, got %T: %v", err, err)
+	}
+	if len(parseErr.Errors) != 1 || parseErr.Errors[0].Line != 3 || !strings.Contains(parseErr.Errors[0].Message, "KEY is set more than once (first on line 1)") {
+		t.Errorf("Expected the second KEY to be reported on line 3, got %v", err)
+	}
+}
+
+func TestWriteItemToEnvFileQuoting(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"simple", `KEY='simple'`},
+		{`has "double" quotes`, `KEY='has "double" quotes'`},
+		{"it's", `KEY="it's"`},
+		{"line1\nline2", `KEY="line1\nline2"`},
+		{`back\slash and 'quote'`, `KEY="back\\slash and 'quote'"`},
+		{`$HOME \n literal`, `KEY='$HOME \n literal'`},
+		{"${USER}@host", `KEY="${USER}@host"`},
+		{"$${USER} literal", `KEY="\${USER} literal"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := "KEY=" + quoteEnvValue(tt.value); got != tt.want {
+				t.Errorf("quoteEnvValue(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"simple",
+		"it's",
+		`"double"`,
+		"multi\nline\nvalue",
+		"-----BEGIN KEY-----\r\nabc\r\n-----END KEY-----",
+		`back\slash\`,
+		`mixed '"\n`,
+		" padded ",
+		"# not a comment",
+		"value # with hash",
+		"='[]",
+		"${A}:${B:-x}",
+		"$${literal}",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		item := &onepassword.OnePasswordItem{
+			Title: "test-item",
+			Fields: []onepassword.OnePasswordField{
+				{Type: "CONCEALED", Label: "FUZZ", Value: value},
+				{Type: "STRING", Label: "AFTER", Value: "sentinel"},
+			},
+		}
+
+		envFile := filepath.Join(t.TempDir(), ".env")
+		if err := WriteItemToEnvFile(envFile, item); err != nil {
+			t.Fatalf("WriteItemToEnvFile failed: %v", err)
+		}
+
+		parsed, err := ParseEnvFileToItem(envFile, "test-item")
+		if err != nil {
+			content, _ := os.ReadFile(envFile)
+			t.Fatalf("ParseEnvFileToItem failed for %q: %v\n%s", value, err, content)
+		}
+
+		got := make(map[string]string)
+		for _, field := range envFields(parsed) {
+			got[field.Label] = field.Value
+		}
+
+		if len(got) != 2 || got["FUZZ"] != value || got["AFTER"] != "sentinel" {
+			t.Errorf("Round trip of %q gave %q", value, got)
+		}
+	})
+}
+
+func TestEmptyValuesRoundTrip(t *testing.T) {
+	envContent := `FEATURE_FLAG=
+QUOTED_EMPTY=""
+
+# Section
+SECTION_EMPTY=
+SET=value`
+
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	if err := os.WriteFile(envFile, []byte(envContent), 0644); err != nil {
+		t.Fatalf("Failed to create test .env file: %v", err)
+	}
+
+	item, err := ParseEnvFileToItem(envFile, "test-item")
+	if err != nil {
+		t.Fatalf("ParseEnvFileToItem failed: %v", err)
+	}
+
+	// Built-in fields of other item categories are not variables
+	item.Fields = append(item.Fields, onepassword.OnePasswordField{
+		ID: "password", Type: "CONCEALED", Purpose: "PASSWORD", Label: "password",
+	})
+
+	outputFile := filepath.Join(tmpDir, "output.env")
+	if err := WriteItemToEnvFile(outputFile, item); err != nil {
+		t.Fatalf("WriteItemToEnvFile failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	for _, want := range []string{"FEATURE_FLAG=\n", "QUOTED_EMPTY=\"\"\n", "SECTION_EMPTY=\n", "SET=value"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Output should contain %q, got:\n%s", want, content)
+		}
+	}
+	if strings.Contains(string(content), "password") {
+		t.Errorf("Empty built-in password field should be left out, got:\n%s", content)
+	}
+}
+
+func TestConcealRules(t *testing.T) {
+	rules := ConcealRules{
+		Include: []string{`^STRIPE_`},
+		Exclude: []string{`_PUBLIC_KEY$`},
+	}
+	conceal, err := rules.compile()
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"STRIPE_ACCOUNT":    "CONCEALED", // include rule
+		"JWT_SECRET":        "CONCEALED", // default rule
+		"STRIPE_PUBLIC_KEY": "STRING",    // exclude wins over include and defaults
+		"PORT":              "STRING",
+	}
+	for name, fieldType := range expected {
+		if got := conceal.fieldType(name); got != fieldType {
+			t.Errorf("fieldType(%q) = %q, want %q", name, got, fieldType)
+		}
+	}
+
+	all, _ := ConcealRules{All: true, Exclude: []string{`^PORT$`}}.compile()
+	if all.fieldType("DEBUG") != "CONCEALED" || all.fieldType("PORT") != "STRING" {
+		t.Errorf("Conceal-all should conceal everything not excluded")
+	}
+
+	if _, err := (ConcealRules{Include: []string{"("}}).compile(); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func TestConcealAnnotationsRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	envFile := filepath.Join(tmpDir, ".env")
+	content := `PUBLIC_KEY=abc # op:text
+# op:concealed
+INTERNAL_URL=https://internal
+
+# Section
+PORT=8080 # op:concealed
+`
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write .env file: %v", err)
+	}
+
+	item, err := ParseEnvFileToItem(envFile, "test")
+	if err != nil {
+		t.Fatalf("ParseEnvFileToItem failed: %v", err)
+	}
+
+	types := make(map[string]string)
+	for _, field := range item.Fields {
+		types[field.Label] = field.Type
+	}
+	expected := map[string]string{"PUBLIC_KEY": "STRING", "INTERNAL_URL": "CONCEALED", "PORT": "CONCEALED"}
+	for label, fieldType := range expected {
+		if types[label] != fieldType {
+			t.Errorf("%s: expected %s, got %s", label, fieldType, types[label])
+		}
+	}
+	if fieldSection(item.Fields[2]) != "Section" {
+		t.Errorf("The annotation line shouldn't start a section, got %+v", item.Fields)
+	}
+
+	// Written back, types that differ from the rules keep their annotation
+	outFile := filepath.Join(tmpDir, ".env.out")
+	if err := WriteItemToEnvFile(outFile, item); err != nil {
+		t.Fatalf("WriteItemToEnvFile failed: %v", err)
+	}
+	written, _ := os.ReadFile(outFile)
+	if string(written) != content {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", written, content)
+	}
+
+	// Without a layout, annotations go inline
+	item.Fields = envFields(item)
+	if err := WriteItemToEnvFile(outFile, item); err != nil {
+		t.Fatalf("WriteItemToEnvFile failed: %v", err)
+	}
+	written, _ = os.ReadFile(outFile)
+	want := `PUBLIC_KEY='abc' # op:text
+INTERNAL_URL='https://internal' # op:concealed
+
+# Section
+PORT='8080' # op:concealed
+`
+	if string(written) != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", written, want)
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ProjectFileName is the name of the project-local configuration file
+const ProjectFileName = ".op-dotenv.toml"
+
+// ProjectFile is the project-local configuration committed with a repository.
+// Unlike Config, it is shared by everyone who clones the repository.
+type ProjectFile struct {
+	Vault   string `toml:"vault"`
+	Account string `toml:"account"` // 1Password account the vault belongs to
+	Item    string `toml:"item"`
+	File    string `toml:"file"` // env file path, relative to the project file
+
+	// Environments map names given to --env to their own file, vault, account and item
+	Environments map[string]EnvironmentConfig `toml:"environments"`
+
+	// Files lists the env files of a project with several, for --recursive
+	Files []ManifestFile `toml:"files"`
+
+	// Conceal decides which variables are concealed for everyone using the project
+	Conceal *ConcealRules `toml:"conceal"`
+
+	path string
+}
+
+// FindProjectFile looks for a project file in startDir and its parents.
+// It returns nil if there is none.
+func FindProjectFile(startDir string) (*ProjectFile, error) {
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if _, err := os.Stat(path); err == nil {
+			return LoadProjectFile(path)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectFile reads a project file. Unknown keys are rejected so typos don't go unnoticed.
+func LoadProjectFile(path string) (*ProjectFile, error) {
+	project := &ProjectFile{path: path}
+
+	meta, err := toml.DecodeFile(path, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		var keys []string
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("failed to read %s: unknown keys %s", path, strings.Join(keys, ", "))
+	}
+
+	return project, nil
+}
+
+// Path returns where the project file was found
+func (p *ProjectFile) Path() string {
+	return p.path
+}
+
+// Dir returns the project root, the directory holding the project file
+func (p *ProjectFile) Dir() string {
+	return filepath.Dir(p.path)
+}
+
+// EnvFilePath returns the configured env file of an environment, or of the
+// project when env is empty, resolved against the project root. It returns ""
+// if none is configured.
+func (p *ProjectFile) EnvFilePath(env string) string {
+	file := p.File
+	if env != "" {
+		file = p.Environments[env].File
+	}
+
+	if file == "" {
+		return ""
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(p.Dir(), file)
+}
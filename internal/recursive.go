@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestFile is one env file of a project with several, such as a service
+// of a monorepo. Vault, account and item default to those of the project, with
+// the item suffixed by the directory of the file.
+type ManifestFile struct {
+	Path    string `toml:"path"` // relative to the project file
+	Vault   string `toml:"vault"`
+	Account string `toml:"account"`
+	Item    string `toml:"item"`
+}
+
+// projectEnvFile is an env file found by projectEnvFiles and where it syncs to
+type projectEnvFile struct {
+	Path    string
+	Vault   string
+	Account string // "" for the account of the project
+	Item    string
+}
+
+// skippedDirs are never searched for env files
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// projectEnvFiles lists the env files of a project with several. Unless dir is
+// given, they come from the [[files]] manifest of the project file. Otherwise
+// dir (the project root by default) is searched for files named like the
+// project's env file, skipping hidden directories, node_modules and vendor.
+//
+// Each file syncs with the project's vault, or vault when set, and an item named
+// after the project item and the directory of the file, like myapp/services/api.
+// Vaults and accounts given with --vault and --account win over the manifest.
+func (a *App) projectEnvFiles(dir, vault string) ([]projectEnvFile, error) {
+	t, err := a.resolveTarget("", vault, "")
+	if err != nil {
+		return nil, err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	root := workingDir
+	var manifest []ManifestFile
+	if t.ProjectPath != "" {
+		root = filepath.Dir(t.ProjectPath)
+		project, err := LoadProjectFile(t.ProjectPath)
+		if err != nil {
+			return nil, err
+		}
+		manifest = project.Files
+	}
+
+	fileFor := func(path string) projectEnvFile {
+		file := projectEnvFile{Path: relPath(workingDir, path), Vault: t.Vault, Item: t.Item}
+		if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			file.Item += "/" + filepath.ToSlash(rel)
+		}
+		return file
+	}
+
+	var files []projectEnvFile
+	if len(manifest) > 0 && dir == "" {
+		for _, entry := range manifest {
+			path := entry.Path
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(root, path)
+			}
+			file := fileFor(path)
+			if entry.Vault != "" && vault == "" {
+				file.Vault = entry.Vault
+			}
+			if entry.Account != "" && a.account == "" {
+				file.Account = entry.Account
+			}
+			if entry.Item != "" {
+				file.Item = entry.Item
+			}
+			files = append(files, file)
+		}
+		return files, nil
+	}
+
+	if dir == "" {
+		dir = root
+	}
+	name := filepath.Base(t.FilePath)
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && (skippedDirs[entry.Name()] || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() == name {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, fileFor(absPath))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s files found in %s", name, dir)
+	}
+	return files, nil
+}
+
+// ForEachFile runs fn once per env file of the project, as listed by the project
+// file's [[files]] or found in dir, with the vault and item the file syncs with.
+// It keeps going when one fails, prints a summary and returns an error if any did.
+func (a *App) ForEachFile(dir, vault string, fn func(filePath, vault, item string) error) error {
+	files, err := a.projectEnvFiles(dir, vault)
+	if err != nil {
+		return err
+	}
+
+	// The files share the working directory, which should keep remembering its own target
+	a.batch = true
+	account := a.account
+	defer func() { a.batch, a.account = false, account }()
+
+	results := make([]error, len(files))
+	for i, file := range files {
+		fmt.Printf("\n%s %s\n", Bold("▸ File"), Bold(file.Path))
+		a.account = account
+		if file.Account != "" {
+			a.account = file.Account
+		}
+		results[i] = fn(file.Path, file.Vault, file.Item)
+		if results[i] != nil {
+			ShowError(fmt.Sprintf("%s %s: %v", Red("✗"), file.Path, results[i]))
+		}
+	}
+
+	fmt.Printf("\n%s\n", Bold("Summary:"))
+	var failed []string
+	for i, file := range files {
+		if results[i] != nil {
+			fmt.Printf("   %s %s: %v\n", Red("✗"), file.Path, results[i])
+			failed = append(failed, file.Path)
+		} else {
+			fmt.Printf("   %s %s ↔ %s\n", Green("✓"), file.Path, file.Vault+"/"+file.Item)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed for %d of %d files: %s", len(failed), len(files), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// Run executes a command with the fields of a 1Password item set as environment
+// variables, with their references expanded. Nothing is written to disk. It
+// returns the exit code of the command.
+func (a *App) Run(vault, item string, args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("no command given, usage: op-dotenv run -- <command> [args...]")
+	}
+
+	_, opItem, err := a.fetchItem(vault, item)
+	if err != nil {
+		return 0, err
+	}
+
+	// Processes get the values references point to
+	opItem, err = a.expandItem(opItem)
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = itemEnviron(os.Environ(), opItem)
+
+	// Start listening before the child exists so no signal slips through
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+
+	// Forward signals to the child and let it decide how to exit
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, err
+	}
+
+	// Mirror the shell convention of 128+n for children killed by a signal
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return exitErr.ExitCode(), nil
+}
+
+// itemEnviron returns environ with the item's fields added, overriding existing variables
+func itemEnviron(environ []string, item *onepassword.OnePasswordItem) []string {
+	fields := envFields(item)
+
+	overridden := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		overridden[field.Label] = true
+	}
+
+	env := make([]string, 0, len(environ)+len(fields))
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if !overridden[key] {
+			env = append(env, kv)
+		}
+	}
+
+	for _, field := range fields {
+		env = append(env, field.Label+"="+field.Value)
+	}
+
+	return env
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
+)
+
+// SyncStatus tells which side of an env file and its item changed since the last sync
+type SyncStatus string
+
+const (
+	StatusInSync      SyncStatus = "in sync"
+	StatusLocalAhead  SyncStatus = "local ahead"
+	StatusRemoteAhead SyncStatus = "remote ahead"
+	StatusDiverged    SyncStatus = "diverged"
+	StatusNeverSynced SyncStatus = "never synced"
+)
+
+// SyncState records an env file and its item at the last successful push or
+// pull. Values are never stored, only keyed hashes of them, which is enough to
+// tell which side changed a variable since then. The key is stored along with
+// them, so they only keep values from being read at a glance: guessable values
+// could be found again from the hashes, and the config is private to the user.
+type SyncState struct {
+	Vault  string            `json:"vault"`
+	Item   string            `json:"item"`
+	Salt   string            `json:"salt"`
+	Fields map[string]string `json:"fields"` // label -> hash of section and value, the base of the next merge
+
+	// The item and file as they were when they last held the same variables.
+	// Version and FileHash are left empty when a sync left one side behind.
+	ItemID    string `json:"itemId,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	FileHash  string `json:"fileHash,omitempty"`
+}
+
+// newSyncState snapshots the variables and notes of an item
+func newSyncState(vault, itemName string, item *onepassword.OnePasswordItem) *SyncState {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+
+	state := &SyncState{
+		Vault:  vault,
+		Item:   itemName,
+		Salt:   hex.EncodeToString(salt),
+		Fields: make(map[string]string),
+	}
+	for label, field := range mergeFields(item) {
+		state.Fields[label] = state.hash(field)
+	}
+	return state
+}
+
+// hash returns the keyed hash of a field, or "" for a missing field
+func (s *SyncState) hash(field *onepassword.OnePasswordField) string {
+	if field == nil {
+		return ""
+	}
+	return s.hashBytes([]byte(fieldSection(*field)), []byte{0}, []byte(field.Value))
+}
+
+// hashBytes returns the keyed hash of the concatenated parts
+func (s *SyncState) hashBytes(parts ...[]byte) string {
+	mac := hmac.New(sha256.New, []byte(s.Salt))
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// localChanged reports whether the file content differs from when it last matched the item
+func (s *SyncState) localChanged(content []byte) bool {
+	return s.FileHash == "" || s.hashBytes(content) != s.FileHash
+}
+
+// remoteChanged reports whether the item was edited since it last matched the file.
+// A nil item was deleted.
+func (s *SyncState) remoteChanged(item *onepassword.OnePasswordItem) bool {
+	if item == nil || s.Version == 0 {
+		return true
+	}
+	return item.ID != s.ItemID || item.Version != s.Version || item.UpdatedAt != s.UpdatedAt
+}
+
+// status compares the current file content and item with the recorded state
+func (s *SyncState) status(content []byte, item *onepassword.OnePasswordItem) SyncStatus {
+	local, remote := s.localChanged(content), s.remoteChanged(item)
+	switch {
+	case local && remote:
+		return StatusDiverged
+	case local:
+		return StatusLocalAhead
+	case remote:
+		return StatusRemoteAhead
+	}
+	return StatusInSync
+}
@@ -1,8 +1,10 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/scriptogre/op-dotenv/internal/onepassword"
 )
@@ -33,10 +35,18 @@ func Red(text string) string {
 	return colorRed + text + colorReset
 }
 
-// ConfirmOverwrite prompts user to confirm overwriting an existing item
-func ConfirmOverwrite(itemType, name, location string) bool {
-	fmt.Printf("\n%s %s '%s' exists in %s. Overwrite? (y/n): ",
-		Yellow("⚠"), itemType, Bold(name), Bold(location))
+// StdinIsTerminal reports whether stdin is attached to a terminal, so prompts can be answered
+func StdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// ConfirmOverwriteNewer prompts user to confirm overwriting changes made since the last sync
+func ConfirmOverwriteNewer(name string) bool {
+	fmt.Printf("\n%s %s changed since the last sync. Overwrite it anyway? (y/n): ", Yellow("⚠"), Bold(name))
 
 	var response string
 	fmt.Scanln(&response)
@@ -49,11 +59,148 @@ func ConfirmOverwrite(itemType, name, location string) bool {
 	return true
 }
 
+// ResolveConflict prompts user to pick the local or 1Password version of a
+// variable changed on both sides. Concealed values are masked unless showValues
+// is set, like in diffs. It returns false for ok if the user cancelled.
+func ResolveConflict(conflict MergeConflict, showValues bool) (useLocal bool, ok bool) {
+	label := conflict.Label
+	if label == "notesPlain" {
+		label = "(notes)"
+	}
+
+	// Both sides are masked if either is concealed
+	concealed := false
+	for _, field := range []*onepassword.OnePasswordField{conflict.Local, conflict.Remote} {
+		concealed = concealed || (field != nil && field.Type == "CONCEALED")
+	}
+	showValues = showValues || !concealed
+
+	fmt.Printf("\n%s %s changed both locally and in 1Password:\n", Yellow("⚠"), Bold(label))
+	fmt.Printf("   local:     %s\n", conflictValue(conflict.Local, showValues))
+	fmt.Printf("   1Password: %s\n", conflictValue(conflict.Remote, showValues))
+	fmt.Print("Keep (l)ocal or (r)emote version? ")
+
+	var response string
+	fmt.Scanln(&response)
+
+	switch strings.ToLower(response) {
+	case "l", "local":
+		return true, true
+	case "r", "remote":
+		return false, true
+	}
+
+	fmt.Println("Operation cancelled.")
+	return false, false
+}
+
+// conflictValue returns one side of a conflict for display, masked unless
+// showValues is set
+func conflictValue(field *onepassword.OnePasswordField, showValues bool) string {
+	if field == nil {
+		return "(deleted)"
+	}
+	value := diffValue(*field, showValues)
+	if section := fieldSection(*field); section != "" {
+		value += " in " + section
+	}
+	return value
+}
+
 // ShowSuccess displays a success message
 func ShowSuccess(action, source, destination string) {
 	fmt.Printf("\n💾 %s %s as %s.\n", action, Bold(source), Bold(destination))
 }
 
+// ShowDiff prints changes between a local file and a 1Password item, grouped by section.
+// Added means the variable only exists locally, removed means it only exists in 1Password.
+func ShowDiff(filePath, itemPath string, changes []FieldChange, showValues bool) {
+	if len(changes) == 0 {
+		fmt.Printf("\n✅ %s and %s are in sync.\n", Bold(filePath), Bold(itemPath))
+		return
+	}
+
+	fmt.Printf("\n🔍 Comparing %s with %s:\n", Bold(filePath), Bold(itemPath))
+
+	// Group changes by section, keeping the order sections first appear in
+	var sectionOrder []string
+	grouped := make(map[string][]FieldChange)
+	for _, change := range changes {
+		section := fieldSection(change.New)
+		if change.Kind == FieldRemoved {
+			section = fieldSection(change.Old)
+		}
+		if _, seen := grouped[section]; !seen {
+			sectionOrder = append(sectionOrder, section)
+		}
+		grouped[section] = append(grouped[section], change)
+	}
+
+	for _, section := range sectionOrder {
+		fmt.Printf("\n%s\n", Bold(sectionName(section)))
+
+		for _, change := range grouped[section] {
+			label := change.Label
+			if label == "notesPlain" {
+				label = "(notes)"
+			}
+
+			switch change.Kind {
+			case FieldAdded:
+				fmt.Printf("   %s %s = %s\n", Green("+"), label, diffValue(change.New, showValues))
+			case FieldRemoved:
+				fmt.Printf("   %s %s = %s\n", Red("-"), label, diffValue(change.Old, showValues))
+			case FieldChanged:
+				fmt.Printf("   %s %s: %s → %s", Yellow("~"), label, diffValue(change.Old, showValues), diffValue(change.New, showValues))
+				if change.Old.Type != change.New.Type && change.Old.Type != "" {
+					fmt.Printf(" (%s → %s)", change.Old.Type, change.New.Type)
+				}
+				if change.SectionChanged() {
+					fmt.Printf(" (moved from %s)", sectionName(fieldSection(change.Old)))
+				}
+				fmt.Println()
+			}
+		}
+	}
+
+	fmt.Printf("\n%s only in %s, %s only in 1Password, %s changed (1Password → local)\n", Green("+"), Bold(filePath), Red("-"), Yellow("~"))
+}
+
+// ShowStatus prints which of a local file and a 1Password item changed since the last sync
+func ShowStatus(filePath, itemPath string, status SyncStatus) {
+	switch status {
+	case StatusInSync:
+		fmt.Printf("\n✅ %s and %s are in sync.\n", Bold(filePath), Bold(itemPath))
+	case StatusLocalAhead:
+		fmt.Printf("\n⬆️  %s changed since the last sync. Push to update %s.\n", Bold(filePath), Bold(itemPath))
+	case StatusRemoteAhead:
+		fmt.Printf("\n⬇️  %s changed since the last sync. Pull to update %s.\n", Bold(itemPath), Bold(filePath))
+	case StatusDiverged:
+		fmt.Printf("\n%s %s and %s both changed since the last sync. Pull to merge them.\n", Yellow("⚠"), Bold(filePath), Bold(itemPath))
+	case StatusNeverSynced:
+		fmt.Printf("\n%s %s has never been synced with %s. Use diff to compare them.\n", Yellow("?"), Bold(filePath), Bold(itemPath))
+	}
+}
+
+// diffValue returns a field value for display, masked unless showValues is set
+func diffValue(field onepassword.OnePasswordField, showValues bool) string {
+	if showValues {
+		return fmt.Sprintf("%q", field.Value)
+	}
+	if field.Value == "" {
+		return "(empty)"
+	}
+	return "********"
+}
+
+// sectionName returns a display name for a section label
+func sectionName(section string) string {
+	if section == "" {
+		return "(no section)"
+	}
+	return section
+}
+
 // ShowError displays an error message to stderr
 func ShowError(message string) {
 	fmt.Fprintln(os.Stderr, message)
@@ -89,11 +236,11 @@ func findSubstring(s, substr string) bool {
 }
 
 // HandleVaultNotFound provides interactive vault selection when a vault is not found
-func HandleVaultNotFound(vaultName string) (string, error) {
+func HandleVaultNotFound(backend onepassword.Backend, vaultName string) (string, error) {
 	fmt.Printf("\n%s Vault '%s' not found.\n\n", Red("✗"), Bold(vaultName))
 
 	// List available vaults
-	vaults, err := onepassword.ListVaults()
+	vaults, err := backend.ListVaults()
 	if err != nil {
 		return "", fmt.Errorf("failed to list vaults: %w", err)
 	}
@@ -132,7 +279,7 @@ func HandleVaultNotFound(vaultName string) (string, error) {
 	case "1":
 		return selectExistingVault(vaults)
 	case "2":
-		return createNewVault()
+		return createNewVault(backend)
 	case "3":
 		fmt.Println("\nOperation cancelled.")
 		return "", nil
@@ -141,16 +288,26 @@ func HandleVaultNotFound(vaultName string) (string, error) {
 	}
 }
 
-// selectExistingVault handles selection of an existing vault
+// selectExistingVault handles selection of an existing vault. A vault sharing
+// its name with another is returned by ID.
 func selectExistingVault(vaults []onepassword.VaultInfo) (string, error) {
 	if len(vaults) == 0 {
 		fmt.Println("No vaults available.")
 		return "", nil
 	}
 
+	vaultNames := make(map[string]int)
+	for _, vault := range vaults {
+		vaultNames[vault.Name]++
+	}
+
 	fmt.Printf("\n📁 %s\n", Bold("Available vaults:"))
 	for i, vault := range vaults {
-		fmt.Printf("   %s %s\n", Yellow(fmt.Sprintf("%d.", i+1)), vault.Name)
+		if vaultNames[vault.Name] > 1 {
+			fmt.Printf("   %s %s (ID: %s)\n", Yellow(fmt.Sprintf("%d.", i+1)), vault.Name, vault.ID)
+		} else {
+			fmt.Printf("   %s %s\n", Yellow(fmt.Sprintf("%d.", i+1)), vault.Name)
+		}
 	}
 	fmt.Printf("\n%s ", Bold("Enter choice:"))
 
@@ -161,13 +318,37 @@ func selectExistingVault(vaults []onepassword.VaultInfo) (string, error) {
 		return "", fmt.Errorf("invalid choice")
 	}
 
-	selectedVault := vaults[vaultChoice-1].Name
-	fmt.Printf("\n✅ Using vault %s.\n", Bold(selectedVault))
-	return selectedVault, nil
+	selected := vaults[vaultChoice-1]
+	fmt.Printf("\n✅ Using vault %s.\n", Bold(selected.Name))
+	if vaultNames[selected.Name] > 1 {
+		return selected.ID, nil
+	}
+	return selected.Name, nil
+}
+
+// ChooseAmbiguousVault asks which of the vaults sharing a name is meant, and
+// returns its ID
+func ChooseAmbiguousVault(ambiguous *onepassword.AmbiguousVaultError) (string, error) {
+	fmt.Printf("\n%s %d vaults are named '%s'.\n", Yellow("⚠"), len(ambiguous.Vaults), Bold(ambiguous.Name))
+	for i, vault := range ambiguous.Vaults {
+		fmt.Printf("   %s %s (ID: %s)\n", Yellow(fmt.Sprintf("%d.", i+1)), vault.Name, vault.ID)
+	}
+	fmt.Printf("\n%s ", Bold("Enter choice:"))
+
+	var vaultChoice int
+	fmt.Scanf("%d", &vaultChoice)
+
+	if vaultChoice < 1 || vaultChoice > len(ambiguous.Vaults) {
+		return "", fmt.Errorf("invalid choice")
+	}
+
+	selected := ambiguous.Vaults[vaultChoice-1]
+	fmt.Printf("\n✅ Using vault %s (ID: %s).\n", Bold(selected.Name), selected.ID)
+	return selected.ID, nil
 }
 
 // createNewVault handles creation of a new vault
-func createNewVault() (string, error) {
+func createNewVault(backend onepassword.Backend) (string, error) {
 	fmt.Printf("\n📝 %s ", Bold("Enter vault name (leave empty for 'Environments'):"))
 	var newVaultName string
 	fmt.Scanln(&newVaultName)
@@ -176,8 +357,12 @@ func createNewVault() (string, error) {
 		newVaultName = "Environments"
 	}
 
-	// Check if vault already exists
-	err := ValidateVault(newVaultName)
+	// Check if vault already exists, once or more
+	err := ValidateVault(backend, newVaultName)
+	var ambiguous *onepassword.AmbiguousVaultError
+	if errors.As(err, &ambiguous) {
+		return ChooseAmbiguousVault(ambiguous)
+	}
 	if err == nil {
 		// Vault already exists
 		fmt.Printf("\n✅ Vault %s already exists. Using existing vault.\n", Bold(newVaultName))
@@ -185,7 +370,7 @@ func createNewVault() (string, error) {
 	}
 
 	// Vault doesn't exist, create it
-	err = onepassword.CreateVault(newVaultName)
+	err = backend.CreateVault(newVaultName)
 	if err != nil {
 		return "", fmt.Errorf("failed to create vault: %w", err)
 	}
@@ -194,12 +379,13 @@ func createNewVault() (string, error) {
 	return newVaultName, nil
 }
 
-// HandleItemNotFound provides interactive options when an item is not found
-func HandleItemNotFound(vaultName, itemName string) (string, error) {
+// HandleItemNotFound provides interactive options when an item is not found in
+// the vault with the given ID, shown by its name
+func HandleItemNotFound(backend onepassword.Backend, vaultID, vaultName, itemName string) (string, error) {
 	fmt.Printf("\n%s Item '%s' not found in vault '%s'.\n\n", Red("✗"), Bold(itemName), Bold(vaultName))
 
 	// List available items in the vault
-	items, err := onepassword.ListItems(vaultName)
+	items, err := backend.ListItems(vaultID)
 	if err != nil {
 		return "", fmt.Errorf("failed to list items: %w", err)
 	}
@@ -1,35 +1,43 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
-	"os/exec"
+
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
 )
 
 // ValidateCliInstalled checks if 1Password CLI is installed
-func ValidateCliInstalled() error {
-	_, err := exec.LookPath("op")
-	if err != nil {
+func ValidateCliInstalled(backend onepassword.Backend) error {
+	if err := backend.CheckInstalled(); err != nil {
 		return fmt.Errorf("🚫 1Password CLI not found\nInstall from: https://developer.1password.com/docs/cli/get-started/")
 	}
 	return nil
 }
 
-// ValidateUserSignedIn checks if user is authenticated with 1Password CLI
-func ValidateUserSignedIn() error {
-	cmd := exec.Command("op", "whoami")
-	if err := cmd.Run(); err != nil {
+// ValidateUserSignedIn checks if user is authenticated with 1Password CLI, to
+// the given account or the default one if it is ""
+func ValidateUserSignedIn(backend onepassword.Backend, account string) error {
+	backend.SetAccount(account)
+	if err := backend.CheckSignedIn(); err != nil {
+		if account != "" {
+			return fmt.Errorf("🔐 1Password CLI not signed in to account '%s'. Run 'op signin --account %s'", account, account)
+		}
 		return fmt.Errorf("🔐 1Password CLI not authenticated. Run 'op signin'")
 	}
 	return nil
 }
 
-// ValidateVault checks if a vault exists
-func ValidateVault(vaultName string) error {
-	cmd := exec.Command("op", "vault", "get", vaultName)
-	if err := cmd.Run(); err != nil {
+// ValidateVault checks if a vault exists. A name several vaults have is
+// returned as an *onepassword.AmbiguousVaultError, since those vaults exist.
+func ValidateVault(backend onepassword.Backend, vaultName string) error {
+	_, err := onepassword.GetVaultIdentifier(backend, vaultName)
+	var ambiguous *onepassword.AmbiguousVaultError
+	if errors.As(err, &ambiguous) {
+		return err
+	}
+	if err != nil {
 		return fmt.Errorf("vault '%s' not found", vaultName)
 	}
 	return nil
 }
-
-
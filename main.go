@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/scriptogre/op-dotenv/internal"
+	"github.com/scriptogre/op-dotenv/internal/onepassword"
 	"github.com/urfave/cli/v3"
 )
 
@@ -29,12 +30,25 @@ func main() {
 			&cli.StringFlag{
 				Name:    "vault",
 				Aliases: []string{"v"},
-				Usage:   "Override vault name (will prompt if not specified)",
+				Usage:   "Override vault name (defaults to the project file, then the last used vault)",
+			},
+			&cli.StringFlag{
+				Name:  "account",
+				Usage: "Use one of several signed-in 1Password accounts, by shorthand, sign-in address, email or ID (defaults to the project file, then the last used account)",
 			},
 			&cli.StringFlag{
 				Name:    "item",
 				Aliases: []string{"i"},
-				Usage:   "Override item name (defaults to current directory name)",
+				Usage:   "Override item name (defaults to the project file, then the project directory name)",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Select an environment (e.g. staging) with its own env file and item",
+			},
+			&cli.BoolFlag{
+				Name:  "non-interactive",
+				Usage: "Fail instead of prompting (enabled automatically when stdin is not a terminal)",
 			},
 		},
 		Commands: []*cli.Command{
@@ -47,26 +61,62 @@ func main() {
 					&cli.BoolFlag{
 						Name:    "force",
 						Aliases: []string{"f"},
-						Usage:   "Force overwrite without confirmation",
+						Usage:   "Overwrite instead of merging with changes on the other side",
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Run for every configured environment",
+					},
+					&cli.BoolFlag{
+						Name:    "recursive",
+						Aliases: []string{"r"},
+						Usage:   "Run for every env file of the project, listed in [[files]] or found below the directory given instead of an env file",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Read the env file as `format`: " + strings.Join(internal.ImportFormatNames(), ", ") + " (told from the file name by default)",
+					},
+					&cli.BoolFlag{
+						Name:  "show-values",
+						Usage: "Show concealed values when asking which side of a conflict to keep",
 					},
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					// Determine file path
-					filePath := ".env"
-					if cmd.NArg() > 0 {
-						filePath = cmd.Args().Get(0)
-					}
+					// Determine file path (resolved from project config when empty)
+					filePath := cmd.Args().Get(0)
 
 					// Create app and execute push
-					app, err := internal.NewApp()
+					app, err := newApp(cmd)
 					if err != nil {
 						return err
 					}
+					if err := app.SetImportFormat(cmd.String("format")); err != nil {
+						return err
+					}
+					app.SetShowValues(cmd.Bool("show-values"))
 
 					vault := cmd.String("vault")
 					item := cmd.String("item")
 					force := cmd.Bool("force")
 
+					if cmd.Bool("all") {
+						if err := checkAllFlags(cmd); err != nil {
+							return err
+						}
+						return app.ForEachEnvironment(func() error {
+							return app.Push("", vault, "", force)
+						})
+					}
+
+					if cmd.Bool("recursive") {
+						if item != "" {
+							return fmt.Errorf("--recursive can't be combined with --item")
+						}
+						return app.ForEachFile(filePath, vault, func(filePath, vault, item string) error {
+							return app.Push(filePath, vault, item, force)
+						})
+					}
+
 					return app.Push(filePath, vault, item, force)
 				},
 			},
@@ -79,62 +129,249 @@ func main() {
 					&cli.BoolFlag{
 						Name:    "force",
 						Aliases: []string{"f"},
-						Usage:   "Force overwrite without confirmation",
+						Usage:   "Overwrite instead of merging with changes on the other side",
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Run for every configured environment",
+					},
+					&cli.BoolFlag{
+						Name:    "recursive",
+						Aliases: []string{"r"},
+						Usage:   "Run for every env file of the project, listed in [[files]] or found below the directory given instead of an env file",
+					},
+					&cli.StringFlag{
+						Name:  "otp",
+						Value: "seed",
+						Usage: "Write OTP fields as their seed or their current TOTP code (`mode`: seed or code)",
+					},
+					&cli.BoolFlag{
+						Name:  "expand",
+						Usage: "Write ${VAR} and op:// references as the values they point to",
+					},
+					&cli.BoolFlag{
+						Name:  "show-values",
+						Usage: "Show concealed values when asking which side of a conflict to keep",
 					},
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					// Determine file path
-					filePath := ".env"
-					if cmd.NArg() > 0 {
-						filePath = cmd.Args().Get(0)
-					}
+					// Determine file path (resolved from project config when empty)
+					filePath := cmd.Args().Get(0)
 
 					// Create app and execute pull
-					app, err := internal.NewApp()
+					app, err := newApp(cmd)
 					if err != nil {
 						return err
 					}
 
+					switch cmd.String("otp") {
+					case "seed":
+					case "code":
+						app.SetOTPCodes(true)
+					default:
+						return fmt.Errorf("invalid --otp %q, expected seed or code", cmd.String("otp"))
+					}
+					app.SetExpand(cmd.Bool("expand"))
+					app.SetShowValues(cmd.Bool("show-values"))
+
 					vault := cmd.String("vault")
 					item := cmd.String("item")
+					force := cmd.Bool("force")
+
+					if cmd.Bool("all") {
+						if err := checkAllFlags(cmd); err != nil {
+							return err
+						}
+						return app.ForEachEnvironment(func() error {
+							return app.Pull("", vault, "", force)
+						})
+					}
 
-					return app.Pull(filePath, vault, item)
+					if cmd.Bool("recursive") {
+						if item != "" {
+							return fmt.Errorf("--recursive can't be combined with --item")
+						}
+						return app.ForEachFile(filePath, vault, func(filePath, vault, item string) error {
+							return app.Pull(filePath, vault, item, force)
+						})
+					}
+
+					return app.Pull(filePath, vault, item, force)
 				},
 			},
 			{
-				Name:        "config",
-				Usage:       "Show current configuration",
-				Description: "Display the current vault and item configuration for this directory",
-				Aliases:     []string{"cfg"},
+				Name:        "diff",
+				Usage:       "Show differences between .env file and 1Password item",
+				Description: "Compare a local .env file with its 1Password item without changing either. Exits with 1 if they differ, 0 if they are in sync and 2 on errors.",
+				ArgsUsage:   "[env-file]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "show-values",
+						Usage: "Show values instead of masking them",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Read the env file as `format`: " + strings.Join(internal.ImportFormatNames(), ", ") + " (told from the file name by default)",
+					},
+				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					config, err := internal.LoadConfig()
+					// Determine file path (resolved from project config when empty)
+					filePath := cmd.Args().Get(0)
+
+					// Create app and execute diff
+					app, err := newApp(cmd)
 					if err != nil {
-						return fmt.Errorf("failed to load config: %w", err)
+						return cli.Exit(err.Error(), 2)
+					}
+					if err := app.SetImportFormat(cmd.String("format")); err != nil {
+						return cli.Exit(err.Error(), 2)
 					}
 
-					workingDir, _ := os.Getwd()
-					
-					// Check if this project has any stored configuration
-					if _, exists := config.Projects[workingDir]; exists {
-						fmt.Printf("Current configuration for %s:\n", workingDir)
-						fmt.Printf("  Vault: %s\n", config.GetVault(workingDir, "Environments"))
-						fmt.Printf("  Item:  %s\n", config.GetItem(workingDir, filepath.Base(workingDir)))
-					} else {
-						fmt.Printf("No configuration found for %s.\n", workingDir)
-						fmt.Printf("Default values will be used:\n")
-						fmt.Printf("  Vault: %s\n", "Environments")
-						fmt.Printf("  Item:  %s\n", filepath.Base(workingDir))
+					vault := cmd.String("vault")
+					item := cmd.String("item")
+					showValues := cmd.Bool("show-values")
+
+					drift, err := app.Diff(filePath, vault, item, showValues)
+					if err != nil {
+						return cli.Exit(err.Error(), 2)
 					}
+					if drift {
+						return cli.Exit("", 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "status",
+				Usage:       "Show whether .env file or 1Password item changed since the last sync",
+				Description: "Report whether the local .env file and its 1Password item are in sync, or which of them changed since the last push or pull. Exits with 1 if they are not in sync, 0 if they are and 2 on errors.",
+				ArgsUsage:   "[env-file]",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					// Determine file path (resolved from project config when empty)
+					filePath := cmd.Args().Get(0)
+
+					// Create app and execute status
+					app, err := newApp(cmd)
+					if err != nil {
+						return cli.Exit(err.Error(), 2)
+					}
+
+					vault := cmd.String("vault")
+					item := cmd.String("item")
 
+					status, err := app.Status(filePath, vault, item)
+					if err != nil {
+						return cli.Exit(err.Error(), 2)
+					}
+					if status != internal.StatusInSync {
+						return cli.Exit("", 1)
+					}
 					return nil
 				},
 			},
+			{
+				Name:        "run",
+				Usage:       "Run a command with 1Password item fields as environment variables",
+				Description: "Fetch the 1Password item and run the command with its fields set as environment variables, with ${VAR} and op:// references expanded. Nothing is written to disk. Signals and the exit code are passed through.",
+				ArgsUsage:   "-- <command> [args...]",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					// Create app and execute run
+					app, err := newApp(cmd)
+					if err != nil {
+						return err
+					}
+
+					vault := cmd.String("vault")
+					item := cmd.String("item")
+
+					code, err := app.Run(vault, item, cmd.Args().Slice())
+					if err != nil {
+						return err
+					}
+					if code != 0 {
+						return cli.Exit("", code)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "inject",
+				Usage:       "Render a template with 1Password item fields",
+				Description: `Fill a config file template (YAML, JSON, ...) with the item's fields and write it to --out or stdout. Use {{ env "KEY" }} for a variable and {{ section "Name" }} for the KEY=value lines of a section, or range over it for .Label and .Value. Placeholders that don't resolve are errors.`,
+				ArgsUsage:   "<template>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "out",
+						Aliases: []string{"o"},
+						Usage:   "Write the rendered template to `file` instead of stdout",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.NArg() != 1 {
+						return fmt.Errorf("expected one template, usage: op-dotenv inject <template> [--out file]")
+					}
+
+					// Create app and execute inject
+					app, err := newApp(cmd)
+					if err != nil {
+						return err
+					}
+
+					vault := cmd.String("vault")
+					item := cmd.String("item")
+
+					return app.Inject(cmd.Args().Get(0), cmd.String("out"), vault, item)
+				},
+			},
+			{
+				Name:        "export",
+				Usage:       "Write 1Password item fields in another format",
+				Description: "Write the item's fields as JSON, YAML, a POSIX shell snippet, a Docker --env-file, a systemd EnvironmentFile or a Kubernetes Secret manifest, to --out or stdout.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "format",
+						Required: true,
+						Usage:    "Output `format`: " + strings.Join(internal.FormatNames(), ", "),
+					},
+					&cli.StringFlag{
+						Name:    "out",
+						Aliases: []string{"o"},
+						Usage:   "Write the export to `file` instead of stdout",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					// Create app and execute export
+					app, err := newApp(cmd)
+					if err != nil {
+						return err
+					}
+
+					vault := cmd.String("vault")
+					item := cmd.String("item")
+
+					return app.Export(cmd.String("format"), cmd.String("out"), vault, item)
+				},
+			},
+			{
+				Name:        "config",
+				Usage:       "Show current configuration",
+				Description: "Display the vault, item and env file used in this directory, and where each value comes from",
+				Aliases:     []string{"cfg"},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					app, err := newApp(cmd)
+					if err != nil {
+						return err
+					}
+
+					return app.ShowConfig(cmd.String("vault"), cmd.String("item"))
+				},
+			},
 			{
 				Name:        "clean",
 				Usage:       "Remove all configuration data",
 				Description: "Delete the configuration file and all stored preferences",
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					app, err := internal.NewApp()
+					app, err := newApp(cmd)
 					if err != nil {
 						return err
 					}
@@ -149,3 +386,27 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// newApp creates the application for a command, with the environment selected
+// by --env and the account selected by --account
+func newApp(cmd *cli.Command) (*internal.App, error) {
+	app, err := internal.NewApp(onepassword.NewCLI())
+	if err != nil {
+		return nil, err
+	}
+
+	app.SelectEnvironment(cmd.String("env"))
+	app.SetAccount(cmd.String("account"))
+	if cmd.Bool("non-interactive") {
+		app.SetInteractive(false)
+	}
+	return app, nil
+}
+
+// checkAllFlags rejects flags that select a single file or item together with --all
+func checkAllFlags(cmd *cli.Command) error {
+	if cmd.NArg() > 0 || cmd.String("item") != "" || cmd.String("env") != "" || cmd.Bool("recursive") {
+		return fmt.Errorf("--all can't be combined with an env file, --item, --env or --recursive")
+	}
+	return nil
+}